@@ -0,0 +1,161 @@
+// Command archive exports an account to a signed archive and imports
+// archives into this server's database.
+//
+//	archive export -email user@example.com -out user.tar [-with-credentials]
+//	archive import -in user.tar [-email new@example.com] [-allow-untrusted]
+//
+// It reads DATABASE_URL, ARCHIVE_SIGNING_KEY (required for export),
+// ARCHIVE_TRUSTED_KEYS and the BLOB_STORE settings from the environment or
+// .env, like the server.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/prudhvinik1/edgesync/internal/blobstore"
+	"github.com/prudhvinik1/edgesync/internal/database"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+func main() {
+	godotenv.Load()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx := context.Background()
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: archive export -email EMAIL -out FILE [-with-credentials]")
+	fmt.Fprintln(os.Stderr, "       archive import -in FILE [-email EMAIL] [-allow-untrusted]")
+	os.Exit(2)
+}
+
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	email := flags.String("email", "", "email of the account to export")
+	outPath := flags.String("out", "", "archive file to write")
+	withCredentials := flags.Bool("with-credentials", false, "include the password hash so the user can log in after import")
+	flags.Parse(args)
+	if *email == "" || *outPath == "" {
+		usage()
+	}
+
+	signingKey, err := archive.ParsePrivateKey(os.Getenv("ARCHIVE_SIGNING_KEY"))
+	if err != nil {
+		return fmt.Errorf("ARCHIVE_SIGNING_KEY: %w", err)
+	}
+
+	pool, err := database.NewPostgresPool(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	defer pool.Close()
+
+	account, err := repositories.NewPostgresAccountRepository(pool).GetByEmail(ctx, *email)
+	if err != nil {
+		return fmt.Errorf("failed to find account %s: %w", *email, err)
+	}
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Offloaded state content is read back from the server's blob store
+	blobs, err := blobstore.Open(os.Getenv("BLOB_STORE"), os.Getenv("BLOB_STORE_PATH"), blobstore.S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		Region:          os.Getenv("S3_REGION"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open blob store: %w", err)
+	}
+
+	archiveRepo := repositories.NewPostgresArchiveRepository(pool).WithBlobStore(blobs)
+	archiveService := services.NewArchiveService(archiveRepo, signingKey, nil)
+	if err := archiveService.Export(ctx, account.ID, out, *withCredentials); err != nil {
+		os.Remove(*outPath)
+		return fmt.Errorf("failed to export account: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Exported account %s to %s", *email, *outPath)
+	return nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	inPath := flags.String("in", "", "archive file to import")
+	email := flags.String("email", "", "email for the imported account (default: the archived email)")
+	allowUntrusted := flags.Bool("allow-untrusted", false, "accept archives from any signer when ARCHIVE_TRUSTED_KEYS is not set")
+	flags.Parse(args)
+	if *inPath == "" {
+		usage()
+	}
+
+	trustedKeys, err := archive.ParsePublicKeys(os.Getenv("ARCHIVE_TRUSTED_KEYS"))
+	if err != nil {
+		return fmt.Errorf("ARCHIVE_TRUSTED_KEYS: %w", err)
+	}
+	if len(trustedKeys) == 0 {
+		if !*allowUntrusted {
+			return fmt.Errorf("ARCHIVE_TRUSTED_KEYS not set; pass -allow-untrusted to accept any correctly signed archive")
+		}
+		log.Println("ARCHIVE_TRUSTED_KEYS not set; accepting any correctly signed archive")
+	}
+
+	in, err := os.Open(*inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	pool, err := database.NewPostgresPool(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	defer pool.Close()
+
+	// Imports bypass the server, so no signing key is needed
+	archiveService := services.NewArchiveService(repositories.NewPostgresArchiveRepository(pool), nil, trustedKeys)
+	if *allowUntrusted {
+		archiveService.AllowUntrustedSigners()
+	}
+	account, err := archiveService.Import(ctx, in, *email)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported account %s as %s", account.Email, account.ID)
+	if account.PasswordHash == "" {
+		log.Println("The archive had no credentials; the account cannot log in with a password")
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,8 +16,14 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/prudhvinik1/edgesync/internal/blobstore"
 	"github.com/prudhvinik1/edgesync/internal/config"
 	"github.com/prudhvinik1/edgesync/internal/database"
+	"github.com/prudhvinik1/edgesync/internal/handlers"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+	"github.com/prudhvinik1/edgesync/internal/services"
 )
 
 func main() {
@@ -40,6 +49,93 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	// Initialize repositories
+	accountRepo := repositories.NewPostgresAccountRepository(postgresPool)
+	deviceRepo := repositories.NewPostgresDeviceRepository(postgresPool)
+	sessionRepo := repositories.NewRedisSessionRepository(redisClient)
+	quotaRepo := repositories.NewPostgresQuotaRepository(postgresPool, models.QuotaLimits{
+		MaxBytes:        cfg.QuotaMaxBytes,
+		MaxKeys:         cfg.QuotaMaxKeys,
+		MaxBlobSize:     cfg.QuotaMaxBlobSize,
+		MaxEventsPerDay: cfg.QuotaMaxEventsPerDay,
+	})
+	blobs, err := blobstore.Open(cfg.BlobStore, cfg.BlobStorePath, blobstore.S3Config{
+		Endpoint:        cfg.S3Endpoint,
+		Bucket:          cfg.S3Bucket,
+		Region:          cfg.S3Region,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+	var stateRepo repositories.EncryptedStateRepository = repositories.NewPostgresEncryptedStateRepository(postgresPool, quotaRepo).
+		WithBlobStore(blobs, cfg.BlobOffloadThreshold)
+	if cfg.StateCacheTTL > 0 {
+		stateCache := repositories.NewCachedEncryptedStateRepository(stateRepo, redisClient, cfg.StateCacheTTL, cfg.StateCacheMaxBlobSize)
+		expvar.Publish("state_cache", expvar.Func(func() any { return stateCache.Stats() }))
+		stateRepo = stateCache
+	}
+	leaseRepo := repositories.NewRedisLeaseRepository(redisClient)
+	stateRepo = repositories.NewLeasedEncryptedStateRepository(stateRepo, leaseRepo)
+	chunkRepo := repositories.NewPostgresChunkRepository(postgresPool, quotaRepo)
+	keyRepo := repositories.NewPostgresEncryptionKeyRepository(postgresPool)
+	shareRepo := repositories.NewPostgresShareRepository(postgresPool)
+	archiveRepo := repositories.NewPostgresArchiveRepository(postgresPool).WithBlobStore(blobs)
+	opLogRepo := repositories.NewPostgresOpLogRepository(postgresPool, quotaRepo)
+	eventRepo := repositories.NewPostgresSyncEventRepository(postgresPool, quotaRepo)
+	presenceRepo := repositories.NewRedisPresenceRepository(redisClient)
+
+	// Initialize services
+	authService := services.NewAuthService(accountRepo, deviceRepo, sessionRepo, cfg.JWTSecret, cfg.JWTExpiry)
+	stateService := services.NewStateService(stateRepo, cfg.TombstoneRetention)
+	eventNotifier := services.NewEventNotifier(cfg.LongPollMaxWaiters, repositories.NewRedisWaiterRepository(redisClient))
+	syncService := services.NewSyncService(repositories.NewPostgresTransactor(postgresPool), stateRepo, chunkRepo, eventRepo, deviceRepo, eventNotifier, cfg.TombstoneRetention)
+	chunkService := services.NewChunkService(chunkRepo, cfg.MaxChunkSize, cfg.ChunkGCGracePeriod)
+	quotaService := services.NewQuotaService(quotaRepo)
+	keyService := services.NewKeyService(keyRepo, stateRepo)
+	leaseService := services.NewLeaseService(leaseRepo)
+	deviceService := services.NewDeviceService(deviceRepo, presenceRepo)
+	shareService := services.NewShareService(shareRepo, stateRepo, accountRepo, chunkRepo)
+	opLogService := services.NewOpLogService(opLogRepo)
+
+	signingKey, trustedKeys, err := loadArchiveKeys(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load archive keys: %v", err)
+	}
+	archiveService := services.NewArchiveService(archiveRepo, signingKey, trustedKeys)
+
+	// Event partitions must exist before anything is written to them
+	if err := syncService.MaintainEventPartitions(ctx, cfg.EventRetention); err != nil {
+		log.Fatalf("Failed to maintain event partitions: %v", err)
+	}
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go chunkService.RunGarbageCollector(jobsCtx, cfg.ChunkGCInterval)
+	go stateService.RunTombstonePurger(jobsCtx, cfg.TombstonePurgeInterval)
+	go syncService.RunExpiryReaper(jobsCtx, cfg.ExpiryReapInterval)
+	go eventNotifier.Run(jobsCtx, eventRepo.Listen)
+	go syncService.RunPartitionMaintainer(jobsCtx, cfg.EventPartitionInterval, cfg.EventRetention)
+	if cfg.EventCompactionAge > 0 {
+		go syncService.RunEventCompactor(jobsCtx, cfg.EventCompactionInterval, cfg.EventCompactionAge)
+	}
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(authService)
+	stateHandler := handlers.NewStateHandler(stateService, syncService)
+	chunkHandler := handlers.NewChunkHandler(chunkService)
+	usageHandler := handlers.NewUsageHandler(quotaService)
+	keyHandler := handlers.NewKeyHandler(keyService)
+	shareHandler := handlers.NewShareHandler(shareService, syncService)
+	exportHandler := handlers.NewExportHandler(archiveService)
+	opLogHandler := handlers.NewOpLogHandler(opLogService)
+	leaseHandler := handlers.NewLeaseHandler(leaseService)
+	syncHandler := handlers.NewSyncHandler(syncService, authService)
+	deviceHandler := handlers.NewDeviceHandler(deviceService)
+	socketHandler := handlers.NewSocketHandler(authService, syncService, deviceService, cfg.WebSocketAllowedOrigins)
+
 	// Initialize HTTP Server
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
@@ -51,6 +147,28 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Runtime and cache metrics
+	router.Handle("/debug/vars", expvar.Handler())
+
+	router.Route("/v1", func(r chi.Router) {
+		authHandler.RegisterRoutes(r)
+
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.AuthMiddleware(authService))
+			stateHandler.RegisterRoutes(r)
+			chunkHandler.RegisterRoutes(r)
+			usageHandler.RegisterRoutes(r)
+			keyHandler.RegisterRoutes(r)
+			shareHandler.RegisterRoutes(r)
+			exportHandler.RegisterRoutes(r)
+			opLogHandler.RegisterRoutes(r)
+			leaseHandler.RegisterRoutes(r)
+			syncHandler.RegisterRoutes(r)
+			deviceHandler.RegisterRoutes(r)
+			socketHandler.RegisterRoutes(r)
+		})
+	})
+
 	// Start Server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.ServerPort),
@@ -64,6 +182,7 @@ func main() {
 		<-sigChan
 
 		log.Println("Shutting down server...")
+		stopJobs()
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		server.Shutdown(ctx)
@@ -76,3 +195,25 @@ func main() {
 
 	log.Println("Server stopped gracefully")
 }
+
+// loadArchiveKeys parses the export signing key and trusted import keys.
+// Without a configured signing key, exports are signed with a key generated
+// at startup: they can still be checked for integrity, but not trusted.
+func loadArchiveKeys(cfg *config.Config) (ed25519.PrivateKey, []ed25519.PublicKey, error) {
+	trustedKeys, err := archive.ParsePublicKeys(cfg.ArchiveTrustedKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.ArchiveSigningKey == "" {
+		log.Println("ARCHIVE_SIGNING_KEY not set; signing exports with an ephemeral key")
+		_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+		return signingKey, trustedKeys, err
+	}
+
+	signingKey, err := archive.ParsePrivateKey(cfg.ArchiveSigningKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signingKey, trustedKeys, nil
+}
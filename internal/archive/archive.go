@@ -0,0 +1,149 @@
+// Package archive reads and writes portable account archives: a tar file
+// holding a signed manifest followed by one NDJSON file per record type.
+//
+// Layout, in order:
+//
+//	manifest.json     Manifest describing the files below
+//	manifest.sig      Ed25519 signature of manifest.json's exact bytes
+//	account.ndjson    one Account
+//	devices.ndjson    Device records
+//	chunks.ndjson     Chunk records
+//	states.ndjson     models.EncryptedState records, including tombstones
+//	op_logs.ndjson    OpLog records, one per key with an op log
+//	ops.ndjson        models.StateOp records after each log's snapshot
+//	events.ndjson     models.SyncEvent records in sequence order
+//	retired_keys.ndjson  models.RetiredKey records
+//
+// Files with no records are omitted. Version 1 archives predate op logs. The manifest lists each file's record
+// count and SHA-256, so any modification after signing is detected.
+package archive
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FormatVersion is the archive format this package writes. Readers reject
+// archives with a newer version.
+const FormatVersion = 2
+
+// Archive member names
+const (
+	FileManifest    = "manifest.json"
+	FileSignature   = "manifest.sig"
+	FileAccount     = "account.ndjson"
+	FileDevices     = "devices.ndjson"
+	FileChunks      = "chunks.ndjson"
+	FileStates      = "states.ndjson"
+	FileOpLogs      = "op_logs.ndjson"
+	FileOps         = "ops.ndjson"
+	FileEvents      = "events.ndjson"
+	FileRetiredKeys = "retired_keys.ndjson"
+)
+
+// fileOrder is the order data files appear in; importers rely on it so that
+// records only refer to records that came before them.
+var fileOrder = []string{FileAccount, FileDevices, FileChunks, FileStates, FileOpLogs, FileOps, FileEvents, FileRetiredKeys}
+
+var (
+	ErrInvalidArchive     = errors.New("invalid archive")
+	ErrInvalidSignature   = errors.New("archive signature is invalid")
+	ErrUntrustedSigner    = errors.New("archive was signed by an untrusted key")
+	ErrUnsupportedVersion = errors.New("unsupported archive format version")
+)
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	FormatVersion   int         `json:"format_version"`
+	ExportedAt      time.Time   `json:"exported_at"`
+	SourceAccountID uuid.UUID   `json:"source_account_id"`
+	SigningKey      []byte      `json:"signing_key"` // Ed25519 public key
+	Files           []FileEntry `json:"files"`
+}
+
+// FileEntry describes one NDJSON file in the archive.
+type FileEntry struct {
+	Name    string `json:"name"`
+	Records int64  `json:"records"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+}
+
+// Account is the account record. PasswordHash is empty in archives exported
+// without credentials; the imported account then can't log in with a password.
+type Account struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Device is a device record, including its public key.
+type Device struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	DeviceType string     `json:"device_type"`
+	PublicKey  *string    `json:"public_key,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Chunk is a content-addressed chunk of a chunked state.
+type Chunk struct {
+	Hash      string    `json:"hash"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpLog is the head of a key's op log: the last position handed out and the
+// latest snapshot, if one was published.
+type OpLog struct {
+	Key              string     `json:"key"`
+	Position         int64      `json:"position"`
+	SnapshotPosition int64      `json:"snapshot_position"`
+	Snapshot         []byte     `json:"snapshot,omitempty"`
+	SnapshotNonce    []byte     `json:"snapshot_nonce,omitempty"`
+	SnapshotDeviceID *uuid.UUID `json:"snapshot_device_id,omitempty"`
+	SnapshotAt       *time.Time `json:"snapshot_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// ParsePrivateKey decodes a base64 Ed25519 seed or private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, errors.New("invalid signing key: wrong length")
+	}
+}
+
+// ParsePublicKeys decodes a comma-separated list of base64 Ed25519 public keys.
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(part)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key %q", part)
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
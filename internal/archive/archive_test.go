@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestArchive(t *testing.T, key ed25519.PrivateKey) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, key)
+	defer w.Close()
+
+	require.NoError(t, w.Add(FileAccount, Account{ID: uuid.New(), Email: "a@example.com"}))
+	require.NoError(t, w.Add(FileChunks, Chunk{Hash: "h1", Data: []byte("one")}))
+	require.NoError(t, w.Add(FileChunks, Chunk{Hash: "h2", Data: []byte("two")}))
+	require.NoError(t, w.Finish(uuid.New()))
+	return buf.Bytes()
+}
+
+func newTestKey(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// TestArchive_RoundTrip tests that records come back in file order
+func TestArchive_RoundTrip(t *testing.T) {
+	key := newTestKey(t)
+	data := writeTestArchive(t, key)
+
+	// ACT: Read with the signer trusted
+	r, err := NewReader(bytes.NewReader(data), []ed25519.PublicKey{key.Public().(ed25519.PublicKey)})
+	require.NoError(t, err)
+
+	var names []string
+	var chunks []Chunk
+	for {
+		name, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, name)
+		if name != FileChunks {
+			continue
+		}
+		for {
+			var chunk Chunk
+			err := r.Decode(&chunk)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	// ASSERT: Unread files are skipped, read files decode intact
+	assert.Equal(t, []string{FileAccount, FileChunks}, names)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, []byte("two"), chunks[1].Data)
+	assert.Equal(t, FormatVersion, r.Manifest().FormatVersion)
+}
+
+// TestArchive_RejectsUntrustedSigner tests that a valid archive from an unknown key is refused
+func TestArchive_RejectsUntrustedSigner(t *testing.T) {
+	data := writeTestArchive(t, newTestKey(t))
+
+	_, err := NewReader(bytes.NewReader(data), []ed25519.PublicKey{newTestKey(t).Public().(ed25519.PublicKey)})
+
+	assert.ErrorIs(t, err, ErrUntrustedSigner)
+}
+
+// TestArchive_DetectsTampering tests that changing a data file after signing is caught
+func TestArchive_DetectsTampering(t *testing.T) {
+	data := writeTestArchive(t, newTestKey(t))
+
+	// ARRANGE: Flip a chunk's payload ("one" is base64 "b25l") in place
+	tampered := bytes.Replace(data, []byte("b25l"), []byte("b25m"), 1)
+	require.NotEqual(t, data, tampered)
+
+	// ACT: Read every file to the end
+	r, err := NewReader(bytes.NewReader(tampered), nil)
+	require.NoError(t, err)
+	var readErr error
+	for readErr == nil {
+		_, readErr = r.Next()
+	}
+
+	// ASSERT
+	assert.ErrorIs(t, readErr, ErrInvalidArchive)
+}
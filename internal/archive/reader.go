@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// maxManifestSize bounds the manifest and signature members.
+const maxManifestSize = 1 << 20
+
+// Reader reads an archive sequentially, verifying the manifest signature up
+// front and each data file's hash and record count as it is consumed.
+type Reader struct {
+	tr       *tar.Reader
+	manifest Manifest
+	entries  map[string]FileEntry
+	seen     map[string]bool
+	last     int // fileOrder index of the last file read
+
+	// current data file
+	entry   FileEntry
+	hash    hash.Hash
+	dec     *json.Decoder
+	records int64
+}
+
+// NewReader reads and verifies the manifest. If trusted is non-empty, the
+// archive must have been signed by one of those keys; otherwise only the
+// archive's integrity is checked.
+func NewReader(in io.Reader, trusted []ed25519.PublicKey) (*Reader, error) {
+	tr := tar.NewReader(in)
+
+	manifestJSON, err := readMember(tr, FileManifest)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := readMember(tr, FileSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrInvalidArchive, err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, manifest.FormatVersion)
+	}
+	if len(manifest.SigningKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: bad signing key", ErrInvalidArchive)
+	}
+	signingKey := ed25519.PublicKey(manifest.SigningKey)
+	if !ed25519.Verify(signingKey, manifestJSON, signature) {
+		return nil, ErrInvalidSignature
+	}
+	if len(trusted) > 0 && !containsKey(trusted, signingKey) {
+		return nil, ErrUntrustedSigner
+	}
+
+	entries := make(map[string]FileEntry)
+	for _, entry := range manifest.Files {
+		if !isDataFile(entry.Name) {
+			return nil, fmt.Errorf("%w: unknown file %q in manifest", ErrInvalidArchive, entry.Name)
+		}
+		entries[entry.Name] = entry
+	}
+
+	return &Reader{tr: tr, manifest: manifest, entries: entries, seen: make(map[string]bool)}, nil
+}
+
+// Manifest returns the verified manifest.
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+// Next advances to the next data file and returns its name, or io.EOF after
+// the last one. Files arrive in the order documented in the package comment.
+func (r *Reader) Next() (string, error) {
+	if r.dec != nil {
+		// Drain and verify the unread rest of the current file
+		for {
+			var skip json.RawMessage
+			if err := r.Decode(&skip); err == io.EOF {
+				break
+			} else if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	header, err := r.tr.Next()
+	if err == io.EOF {
+		for name := range r.entries {
+			if !r.seen[name] {
+				return "", fmt.Errorf("%w: %s is missing", ErrInvalidArchive, name)
+			}
+		}
+		return "", io.EOF
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	entry, ok := r.entries[header.Name]
+	if !ok || r.seen[header.Name] || fileIndex(header.Name) < r.last {
+		return "", fmt.Errorf("%w: unexpected file %q", ErrInvalidArchive, header.Name)
+	}
+	r.seen[header.Name] = true
+	r.last = fileIndex(header.Name)
+
+	r.entry = entry
+	r.hash = sha256.New()
+	r.dec = json.NewDecoder(io.TeeReader(r.tr, r.hash))
+	r.records = 0
+	return header.Name, nil
+}
+
+// Decode reads the next record of the current file into v. At the end of
+// the file it checks the file against the manifest and returns io.EOF.
+func (r *Reader) Decode(v any) error {
+	if r.dec == nil {
+		return io.EOF
+	}
+
+	err := r.dec.Decode(v)
+	if err == io.EOF {
+		// Hash whatever the decoder has not read yet
+		if _, err := io.Copy(r.hash, r.tr); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		r.dec = nil
+		if r.records != r.entry.Records || hex.EncodeToString(r.hash.Sum(nil)) != r.entry.SHA256 {
+			return fmt.Errorf("%w: %s does not match the manifest", ErrInvalidArchive, r.entry.Name)
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("%w: bad record in %s: %v", ErrInvalidArchive, r.entry.Name, err)
+	}
+	r.records++
+	return nil
+}
+
+func readMember(tr *tar.Reader, name string) ([]byte, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, name)
+	}
+	if header.Name != name {
+		return nil, fmt.Errorf("%w: expected %s, found %s", ErrInvalidArchive, name, header.Name)
+	}
+	data, err := io.ReadAll(io.LimitReader(tr, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalidArchive, name)
+	}
+	return data, nil
+}
+
+func fileIndex(name string) int {
+	for i, f := range fileOrder {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsKey(keys []ed25519.PublicKey, key ed25519.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Writer builds an archive. Records are spooled to temporary files until
+// Finish, because the manifest (which comes first) needs every file's hash.
+type Writer struct {
+	out        io.Writer
+	signingKey ed25519.PrivateKey
+	files      map[string]*spool
+}
+
+type spool struct {
+	file    *os.File
+	buf     *bufio.Writer
+	hash    hash.Hash
+	enc     *json.Encoder
+	records int64
+	size    int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	s.hash.Write(p)
+	s.size += int64(len(p))
+	return s.buf.Write(p)
+}
+
+func NewWriter(out io.Writer, signingKey ed25519.PrivateKey) *Writer {
+	return &Writer{out: out, signingKey: signingKey, files: make(map[string]*spool)}
+}
+
+// Add appends a record to the named data file.
+func (w *Writer) Add(name string, record any) error {
+	s, ok := w.files[name]
+	if !ok {
+		if !isDataFile(name) {
+			return fmt.Errorf("%w: unknown file %q", ErrInvalidArchive, name)
+		}
+		file, err := os.CreateTemp("", "edgesync-archive-*")
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		s = &spool{file: file, buf: bufio.NewWriter(file), hash: sha256.New()}
+		s.enc = json.NewEncoder(s)
+		w.files[name] = s
+	}
+
+	if err := s.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to encode %s record: %w", name, err)
+	}
+	s.records++
+	return nil
+}
+
+// Finish writes the signed manifest and all data files to the output.
+func (w *Writer) Finish(sourceAccountID uuid.UUID) error {
+	manifest := Manifest{
+		FormatVersion:   FormatVersion,
+		ExportedAt:      time.Now().UTC(),
+		SourceAccountID: sourceAccountID,
+		SigningKey:      w.signingKey.Public().(ed25519.PublicKey),
+		Files:           []FileEntry{},
+	}
+	for _, name := range fileOrder {
+		s, ok := w.files[name]
+		if !ok {
+			continue
+		}
+		if err := s.buf.Flush(); err != nil {
+			return fmt.Errorf("failed to flush %s: %w", name, err)
+		}
+		manifest.Files = append(manifest.Files, FileEntry{
+			Name:    name,
+			Records: s.records,
+			Size:    s.size,
+			SHA256:  hex.EncodeToString(s.hash.Sum(nil)),
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	signature := ed25519.Sign(w.signingKey, manifestJSON)
+
+	tw := tar.NewWriter(w.out)
+	if err := writeMember(tw, FileManifest, manifestJSON); err != nil {
+		return err
+	}
+	if err := writeMember(tw, FileSignature, signature); err != nil {
+		return err
+	}
+
+	for _, entry := range manifest.Files {
+		s := w.files[entry.Name]
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind %s: %w", entry.Name, err)
+		}
+		header := &tar.Header{Name: entry.Name, Mode: 0o600, Size: entry.Size, ModTime: manifest.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write %s header: %w", entry.Name, err)
+		}
+		if _, err := io.Copy(tw, s.file); err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// Close removes the spool files. It is safe to call after Finish.
+func (w *Writer) Close() error {
+	for _, s := range w.files {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+	w.files = make(map[string]*spool)
+	return nil
+}
+
+func writeMember(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now().UTC()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func isDataFile(name string) bool {
+	return fileIndex(name) >= 0
+}
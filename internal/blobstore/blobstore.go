@@ -0,0 +1,57 @@
+// Package blobstore stores opaque blobs outside Postgres. The state
+// repository uses it for ciphertext above a configurable size.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that holds no blob
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys a backend can't store safely
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore is a flat key-value store for immutable blobs. Keys are
+// slash-separated paths such as "states/<account>/<id>". Put overwrites,
+// and Delete of a missing key succeeds.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Open creates the store named by backend: "filesystem" (blobs under path) or
+// "s3". An empty backend means no blob store, and Open returns nil.
+func Open(backend, path string, s3 S3Config) (BlobStore, error) {
+	switch backend {
+	case "":
+		return nil, nil
+	case "filesystem":
+		if path == "" {
+			return nil, errors.New("blob store path is required")
+		}
+		return NewFilesystemStore(path)
+	case "s3":
+		return NewS3Store(s3)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", backend)
+	}
+}
+
+// validKey rejects empty keys, empty or dot segments, and backslashes, so
+// keys map onto file paths and object names the same way everywhere.
+func validKey(key string) bool {
+	if key == "" || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFilesystemStore runs the shared BlobStore checks against a temp directory
+func TestFilesystemStore(t *testing.T) {
+	store, err := NewFilesystemStore(t.TempDir())
+	require.NoError(t, err)
+
+	testBlobStore(t, store)
+}
+
+// TestS3Store runs the shared BlobStore checks against an in-process fake S3
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3("edgesync")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "edgesync",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	})
+	require.NoError(t, err)
+
+	testBlobStore(t, store)
+
+	// ASSERT: Objects were stored under the bucket, path-style
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Contains(t, fake.objects, "/edgesync/states/acct/kept")
+}
+
+// TestOpen_RejectsUnknownBackend tests that a typo in the backend name is an error
+func TestOpen_RejectsUnknownBackend(t *testing.T) {
+	store, err := Open("", "", S3Config{})
+	require.NoError(t, err)
+	assert.Nil(t, store, "No backend should mean no blob store")
+
+	_, err = Open("gcs", "", S3Config{})
+	assert.Error(t, err)
+}
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	// ACT: Store, overwrite and read back a blob
+	require.NoError(t, store.Put(ctx, "states/acct/kept", []byte("first")))
+	require.NoError(t, store.Put(ctx, "states/acct/kept", []byte("second")))
+	data, err := store.Get(ctx, "states/acct/kept")
+
+	// ASSERT: The latest content is returned
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), data)
+
+	// Empty blobs round-trip too
+	require.NoError(t, store.Put(ctx, "states/acct/empty", []byte{}))
+	data, err = store.Get(ctx, "states/acct/empty")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	// Deleted and unknown keys are not found; deleting twice is fine
+	require.NoError(t, store.Put(ctx, "states/acct/gone", []byte("x")))
+	require.NoError(t, store.Delete(ctx, "states/acct/gone"))
+	require.NoError(t, store.Delete(ctx, "states/acct/gone"))
+	_, err = store.Get(ctx, "states/acct/gone")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Get(ctx, "states/acct/never")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Keys that could escape the store are rejected
+	for _, key := range []string{"", "../escape", "states//double", "states/./dot", `states\back`} {
+		assert.ErrorIs(t, store.Put(ctx, key, []byte("x")), ErrInvalidKey, "key %q", key)
+	}
+}
+
+// fakeS3 implements PUT, GET and DELETE object for one bucket. It checks
+// that requests carry a SigV4 Authorization header for the expected bucket
+// region and a payload hash matching the body.
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") {
+		http.Error(w, "bad authorization: "+auth, http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "missing date", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/"+f.bucket+"/") {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
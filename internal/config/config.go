@@ -1,18 +1,47 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
-	"errors"
 )
 
-
 type Config struct {
-	ServerPort string
-	DatabaseURL string
-	RedisURL string
-	JWTSecret string
-	JWTExpiry time.Duration
+	ServerPort              string
+	DatabaseURL             string
+	RedisURL                string
+	JWTSecret               string
+	JWTExpiry               time.Duration
+	MaxChunkSize            int
+	ChunkGCInterval         time.Duration
+	ChunkGCGracePeriod      time.Duration
+	TombstoneRetention      time.Duration
+	TombstonePurgeInterval  time.Duration
+	ExpiryReapInterval      time.Duration
+	EventCompactionAge      time.Duration
+	EventCompactionInterval time.Duration
+	EventRetention          time.Duration
+	EventPartitionInterval  time.Duration
+	LongPollMaxWaiters      int
+	WebSocketAllowedOrigins []string
+	QuotaMaxBytes           int64
+	QuotaMaxKeys            int64
+	QuotaMaxBlobSize        int64
+	QuotaMaxEventsPerDay    int64
+	ArchiveSigningKey       string
+	ArchiveTrustedKeys      string
+	StateCacheTTL           time.Duration
+	StateCacheMaxBlobSize   int
+	BlobStore               string
+	BlobStorePath           string
+	BlobOffloadThreshold    int
+	S3Endpoint              string
+	S3Bucket                string
+	S3Region                string
+	S3AccessKeyID           string
+	S3SecretAccessKey       string
 }
 
 func LoadConfig() (*Config, error) {
@@ -22,12 +51,143 @@ func LoadConfig() (*Config, error) {
 		return nil, errors.New("invalid JWT_EXPIRY format")
 	}
 
+	maxChunkSize, err := getEnvInt("MAX_CHUNK_SIZE", 4<<20)
+	if err != nil || maxChunkSize <= 0 {
+		return nil, errors.New("invalid MAX_CHUNK_SIZE")
+	}
+
+	chunkGCInterval, err := time.ParseDuration(getEnv("CHUNK_GC_INTERVAL", "1h"))
+	if err != nil || chunkGCInterval <= 0 {
+		return nil, errors.New("invalid CHUNK_GC_INTERVAL format")
+	}
+
+	chunkGCGracePeriod, err := time.ParseDuration(getEnv("CHUNK_GC_GRACE_PERIOD", "24h"))
+	if err != nil {
+		return nil, errors.New("invalid CHUNK_GC_GRACE_PERIOD format")
+	}
+
+	tombstoneRetention, err := time.ParseDuration(getEnv("TOMBSTONE_RETENTION", "720h"))
+	if err != nil {
+		return nil, errors.New("invalid TOMBSTONE_RETENTION format")
+	}
+
+	tombstonePurgeInterval, err := time.ParseDuration(getEnv("TOMBSTONE_PURGE_INTERVAL", "1h"))
+	if err != nil || tombstonePurgeInterval <= 0 {
+		return nil, errors.New("invalid TOMBSTONE_PURGE_INTERVAL format")
+	}
+
+	expiryReapInterval, err := time.ParseDuration(getEnv("EXPIRY_REAP_INTERVAL", "30s"))
+	if err != nil || expiryReapInterval <= 0 {
+		return nil, errors.New("invalid EXPIRY_REAP_INTERVAL format")
+	}
+
+	// Events older than this are compacted to the latest one per key; devices
+	// offline for longer resync from a snapshot. 0 disables compaction.
+	eventCompactionAge, err := time.ParseDuration(getEnv("EVENT_COMPACTION_AGE", "720h"))
+	if err != nil || eventCompactionAge < 0 {
+		return nil, errors.New("invalid EVENT_COMPACTION_AGE format")
+	}
+	eventCompactionInterval, err := time.ParseDuration(getEnv("EVENT_COMPACTION_INTERVAL", "1h"))
+	if err != nil || eventCompactionInterval <= 0 {
+		return nil, errors.New("invalid EVENT_COMPACTION_INTERVAL format")
+	}
+
+	// Monthly event partitions older than the retention are dropped; 0 keeps
+	// them forever
+	eventRetention, err := time.ParseDuration(getEnv("EVENT_RETENTION", "0s"))
+	if err != nil || eventRetention < 0 {
+		return nil, errors.New("invalid EVENT_RETENTION format")
+	}
+	eventPartitionInterval, err := time.ParseDuration(getEnv("EVENT_PARTITION_INTERVAL", "1h"))
+	if err != nil || eventPartitionInterval <= 0 {
+		return nil, errors.New("invalid EVENT_PARTITION_INTERVAL format")
+	}
+
+	// Long-polling requests allowed to wait at once per account, across all
+	// instances; 0 means unlimited
+	longPollMaxWaiters, err := getEnvInt("LONG_POLL_MAX_WAITERS", 16)
+	if err != nil || longPollMaxWaiters < 0 {
+		return nil, errors.New("invalid LONG_POLL_MAX_WAITERS")
+	}
+
+	// Origins besides the server's own that browsers may open sync sockets
+	// from, comma-separated, e.g. "https://app.example.com"
+	webSocketAllowedOrigins := getEnvList("WEBSOCKET_ALLOWED_ORIGINS")
+
+	// The Redis state cache is off unless STATE_CACHE_TTL is set
+	stateCacheTTL, err := time.ParseDuration(getEnv("STATE_CACHE_TTL", "0s"))
+	if err != nil {
+		return nil, errors.New("invalid STATE_CACHE_TTL format")
+	}
+	stateCacheMaxBlobSize, err := getEnvInt("STATE_CACHE_MAX_BLOB_SIZE", 64<<10)
+	if err != nil || stateCacheMaxBlobSize < 0 {
+		return nil, errors.New("invalid STATE_CACHE_MAX_BLOB_SIZE")
+	}
+
+	// States larger than the threshold go to the blob store, if one is set
+	blobStore := getEnv("BLOB_STORE", "")
+	if blobStore != "" && blobStore != "filesystem" && blobStore != "s3" {
+		return nil, errors.New("invalid BLOB_STORE: must be filesystem or s3")
+	}
+	blobOffloadThreshold, err := getEnvInt("BLOB_OFFLOAD_THRESHOLD", 64<<10)
+	if err != nil || blobOffloadThreshold < 0 {
+		return nil, errors.New("invalid BLOB_OFFLOAD_THRESHOLD")
+	}
+
+	// Default per-account quotas; 0 means unlimited
+	quotaMaxBytes, err := getEnvInt("QUOTA_MAX_BYTES", 1<<30)
+	if err != nil {
+		return nil, errors.New("invalid QUOTA_MAX_BYTES")
+	}
+	quotaMaxKeys, err := getEnvInt("QUOTA_MAX_KEYS", 10000)
+	if err != nil {
+		return nil, errors.New("invalid QUOTA_MAX_KEYS")
+	}
+	quotaMaxBlobSize, err := getEnvInt("QUOTA_MAX_BLOB_SIZE", 16<<20)
+	if err != nil {
+		return nil, errors.New("invalid QUOTA_MAX_BLOB_SIZE")
+	}
+	quotaMaxEventsPerDay, err := getEnvInt("QUOTA_MAX_EVENTS_PER_DAY", 100000)
+	if err != nil {
+		return nil, errors.New("invalid QUOTA_MAX_EVENTS_PER_DAY")
+	}
+
 	cfg := &Config{
-		ServerPort:  getEnv("SERVER_PORT", "8080"),
-		DatabaseURL: os.Getenv("DATABASE_URL"),
-		RedisURL:    os.Getenv("REDIS_URL"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
-		JWTExpiry:   expiry,
+		ServerPort:              getEnv("SERVER_PORT", "8080"),
+		DatabaseURL:             os.Getenv("DATABASE_URL"),
+		RedisURL:                os.Getenv("REDIS_URL"),
+		JWTSecret:               os.Getenv("JWT_SECRET"),
+		JWTExpiry:               expiry,
+		MaxChunkSize:            int(maxChunkSize),
+		ChunkGCInterval:         chunkGCInterval,
+		ChunkGCGracePeriod:      chunkGCGracePeriod,
+		TombstoneRetention:      tombstoneRetention,
+		TombstonePurgeInterval:  tombstonePurgeInterval,
+		ExpiryReapInterval:      expiryReapInterval,
+		EventCompactionAge:      eventCompactionAge,
+		EventCompactionInterval: eventCompactionInterval,
+		EventRetention:          eventRetention,
+		EventPartitionInterval:  eventPartitionInterval,
+		LongPollMaxWaiters:      int(longPollMaxWaiters),
+		WebSocketAllowedOrigins: webSocketAllowedOrigins,
+		QuotaMaxBytes:           quotaMaxBytes,
+		QuotaMaxKeys:            quotaMaxKeys,
+		QuotaMaxBlobSize:        quotaMaxBlobSize,
+		QuotaMaxEventsPerDay:    quotaMaxEventsPerDay,
+		StateCacheTTL:           stateCacheTTL,
+		StateCacheMaxBlobSize:   int(stateCacheMaxBlobSize),
+		BlobStore:               blobStore,
+		BlobStorePath:           os.Getenv("BLOB_STORE_PATH"),
+		BlobOffloadThreshold:    int(blobOffloadThreshold),
+		S3Endpoint:              os.Getenv("S3_ENDPOINT"),
+		S3Bucket:                os.Getenv("S3_BUCKET"),
+		S3Region:                os.Getenv("S3_REGION"),
+		S3AccessKeyID:           os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:       os.Getenv("S3_SECRET_ACCESS_KEY"),
+		// Base64 Ed25519 seed used to sign exports, and comma-separated
+		// base64 public keys whose archives may be imported
+		ArchiveSigningKey:  os.Getenv("ARCHIVE_SIGNING_KEY"),
+		ArchiveTrustedKeys: os.Getenv("ARCHIVE_TRUSTED_KEYS"),
 	}
 
 	// Validate required fields
@@ -50,4 +210,24 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// Helper: get comma-separated env values, empty ones dropped
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Helper: get integer env with default value
+func getEnvInt(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
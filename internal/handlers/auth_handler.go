@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type AuthHandler struct {
+	authService *services.AuthService
+}
+
+func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+	return &AuthHandler{authService: authService}
+}
+
+// RegisterRoutes mounts the unauthenticated auth endpoints.
+func (h *AuthHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/auth/register", h.Register)
+	r.Post("/auth/login", h.Login)
+	r.Post("/auth/logout", h.Logout)
+}
+
+type registerRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginRequest struct {
+	Email      string     `json:"email"`
+	Password   string     `json:"password"`
+	DeviceID   *uuid.UUID `json:"device_id,omitempty"`
+	DeviceName string     `json:"device_name"`
+	DeviceType string     `json:"device_type"`
+}
+
+type loginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	AccountID uuid.UUID `json:"account_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "email and password are required")
+		return
+	}
+
+	err := h.authService.Register(r.Context(), req.Email, req.Password)
+	if err == services.ErrEmailExists {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.authService.Login(r.Context(), services.LoginRequest{
+		Email:      req.Email,
+		Password:   req.Password,
+		DeviceID:   req.DeviceID,
+		DeviceName: req.DeviceName,
+		DeviceType: req.DeviceType,
+	})
+	if err == services.ErrInvalidCredentials {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loginResponse{
+		Token:     resp.Token,
+		ExpiresAt: resp.ExpiresAt,
+		AccountID: resp.AccountID,
+		DeviceID:  resp.DeviceID,
+	})
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	err := h.authService.Logout(r.Context(), token)
+	if err == services.ErrInvalidToken {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type ChunkHandler struct {
+	chunkService *services.ChunkService
+}
+
+func NewChunkHandler(chunkService *services.ChunkService) *ChunkHandler {
+	return &ChunkHandler{chunkService: chunkService}
+}
+
+// RegisterRoutes mounts the chunk endpoints. Routes must be behind AuthMiddleware.
+func (h *ChunkHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/chunks/missing", h.Missing)
+	r.Put("/chunks/{hash}", h.Put)
+	r.Get("/chunks/{hash}", h.Get)
+}
+
+type missingChunksRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+type missingChunksResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// Missing returns which of the given chunk hashes still need uploading.
+func (h *ChunkHandler) Missing(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req missingChunksRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Hashes) > services.MaxChunksPerState {
+		writeServiceError(w, services.ErrTooManyChunks)
+		return
+	}
+
+	missing, err := h.chunkService.MissingChunks(r.Context(), claims.AccountID, req.Hashes)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, missingChunksResponse{Missing: missing})
+}
+
+// Put uploads one chunk as a raw request body.
+func (h *ChunkHandler) Put(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	hash := chi.URLParam(r, "hash")
+
+	body := http.MaxBytesReader(w, r.Body, int64(h.chunkService.MaxChunkSize()))
+	data, err := io.ReadAll(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeServiceError(w, services.ErrChunkTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read chunk")
+		return
+	}
+
+	if err := h.chunkService.PutChunk(r.Context(), claims.AccountID, hash, data); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ChunkHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	hash := chi.URLParam(r, "hash")
+
+	chunk, err := h.chunkService.GetChunk(r.Context(), claims.AccountID, hash)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(chunk.Data)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chunk.Data)
+}
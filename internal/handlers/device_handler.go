@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type DeviceHandler struct {
+	deviceService *services.DeviceService
+}
+
+func NewDeviceHandler(deviceService *services.DeviceService) *DeviceHandler {
+	return &DeviceHandler{deviceService: deviceService}
+}
+
+// RegisterRoutes mounts the device endpoints. Routes must be behind AuthMiddleware.
+func (h *DeviceHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/devices", h.List)
+}
+
+type listDevicesResponse struct {
+	Devices []*models.DeviceStatus `json:"devices"`
+}
+
+// List returns the caller's devices with how far each lags behind the
+// account's event stream.
+func (h *DeviceHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	devices, err := h.deviceService.List(r.Context(), claims.AccountID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listDevicesResponse{Devices: devices})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// etag formats a state's version and content hash as a strong entity tag.
+// Every write, including one that only changes metadata or restores earlier
+// content, takes a new version, so the tag changes with the representation.
+func etag(state *models.EncryptedState) string {
+	return `"` + strconv.FormatInt(state.Version, 10) + "-" + state.ContentHash + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// matches the state's tag. "*" matches any existing representation. With
+// weak set (If-None-Match) a W/ prefix is ignored; otherwise weak tags never
+// match (If-Match uses strong comparison).
+func etagMatches(header string, state *models.EncryptedState, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag(state) {
+			return true
+		}
+	}
+	return false
+}
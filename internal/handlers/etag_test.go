@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestETagMatches tests If-Match/If-None-Match header matching rules
+func TestETagMatches(t *testing.T) {
+	state := &models.EncryptedState{Version: 3, ContentHash: "abc123"}
+
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"exact tag", `"3-abc123"`, false, true},
+		{"other tag", `"3-def456"`, false, false},
+		{"list containing tag", `"3-def456", "3-abc123"`, false, true},
+		{"wildcard", `*`, false, true},
+		{"weak tag with strong comparison", `W/"3-abc123"`, false, false},
+		{"weak tag with weak comparison", `W/"3-abc123"`, true, true},
+		{"unquoted tag", `3-abc123`, false, false},
+		{"empty header", ``, false, false},
+		{"same content at an earlier version", `"1-abc123"`, false, false},
+		{"content hash alone", `"abc123"`, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.header, state, tt.weak))
+		})
+	}
+}
+
+// TestETagChangesWithEveryWrite tests that writes which keep or restore the content still change the tag
+func TestETagChangesWithEveryWrite(t *testing.T) {
+	// A→B→A: the content returns but the version has moved on
+	a := &models.EncryptedState{Version: 1, ContentHash: "hash-a"}
+	restored := &models.EncryptedState{Version: 3, ContentHash: "hash-a"}
+	assert.NotEqual(t, etag(a), etag(restored))
+
+	// A metadata-only write keeps the content hash
+	rekeyed := &models.EncryptedState{Version: 2, ContentHash: "hash-a", EncryptionEnvelope: models.EncryptionEnvelope{KeyID: "k2"}}
+	assert.NotEqual(t, etag(a), etag(rekeyed))
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type ExportHandler struct {
+	archiveService *services.ArchiveService
+}
+
+func NewExportHandler(archiveService *services.ArchiveService) *ExportHandler {
+	return &ExportHandler{archiveService: archiveService}
+}
+
+// RegisterRoutes mounts the export endpoint. Routes must be behind AuthMiddleware.
+func (h *ExportHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/export", h.Export)
+}
+
+// Export downloads a signed archive of the caller's account. The archive
+// leaves out the password hash.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	filename := fmt.Sprintf("edgesync-%s-%s.tar", claims.AccountID, time.Now().UTC().Format("20060102"))
+	out := &attachmentWriter{w: w, filename: filename}
+
+	err := h.archiveService.Export(r.Context(), claims.AccountID, out, false)
+	if err != nil && !out.started {
+		writeServiceError(w, err)
+		return
+	}
+	if err != nil {
+		// Too late for an error status; the client sees a truncated archive
+		log.Printf("export of account %s failed: %v", claims.AccountID, err)
+	}
+}
+
+// attachmentWriter sends the download headers on the first write, so errors
+// before any output can still get a proper error response.
+type attachmentWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (a *attachmentWriter) Write(p []byte) (int, error) {
+	if !a.started {
+		a.started = true
+		a.w.Header().Set("Content-Type", "application/x-tar")
+		a.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.filename))
+		a.w.WriteHeader(http.StatusOK)
+	}
+	return a.w.Write(p)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type KeyHandler struct {
+	keyService *services.KeyService
+}
+
+func NewKeyHandler(keyService *services.KeyService) *KeyHandler {
+	return &KeyHandler{keyService: keyService}
+}
+
+// RegisterRoutes mounts the key rotation endpoints. Routes must be behind AuthMiddleware.
+// Key IDs are client-chosen and may contain slashes, so they travel in the
+// query string or body rather than the path.
+func (h *KeyHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/keys/states", h.States)
+	r.Get("/keys/retired", h.ListRetired)
+	r.Post("/keys/retired", h.Retire)
+}
+
+type retireKeyRequest struct {
+	KeyID string `json:"key_id"`
+}
+
+type retiredKeysResponse struct {
+	Keys []*models.RetiredKey `json:"keys"`
+}
+
+// States lists metadata for the caller's states still encrypted under a key:
+// GET /keys/states?key_id=k1
+func (h *KeyHandler) States(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	entries, err := h.keyService.StatesByKeyID(r.Context(), claims.AccountID, claims.DeviceID, r.URL.Query().Get("key_id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, manifestResponse{Entries: entries})
+}
+
+// ListRetired returns the caller's retired key IDs.
+func (h *KeyHandler) ListRetired(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	keys, err := h.keyService.ListRetired(r.Context(), claims.AccountID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, retiredKeysResponse{Keys: keys})
+}
+
+// Retire marks a key ID as retired; later writes under it are rejected with 409.
+func (h *KeyHandler) Retire(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req retireKeyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := h.keyService.Retire(r.Context(), claims.AccountID, req.KeyID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, key)
+}
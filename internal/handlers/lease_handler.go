@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type LeaseHandler struct {
+	leaseService *services.LeaseService
+}
+
+func NewLeaseHandler(leaseService *services.LeaseService) *LeaseHandler {
+	return &LeaseHandler{leaseService: leaseService}
+}
+
+// RegisterRoutes mounts the edit lease endpoints. Routes must be behind AuthMiddleware.
+// Leases are keyed like states; the lease holder is the calling device.
+func (h *LeaseHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/leases/*", h.Get)
+	r.Post("/leases/*", h.Acquire)
+	r.Put("/leases/*", h.Renew)
+	r.Delete("/leases/*", h.Release)
+}
+
+type acquireLeaseRequest struct {
+	TTLSeconds int  `json:"ttl_seconds"`
+	Enforce    bool `json:"enforce"`
+}
+
+type renewLeaseRequest struct {
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// Get returns who holds the lease on a key: GET /leases/{key}
+func (h *LeaseHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	lease, err := h.leaseService.Get(r.Context(), claims.AccountID, stateKey(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lease)
+}
+
+// Acquire takes the lease on a key: POST /leases/{key} {"ttl_seconds": 30, "enforce": true}
+// Returns 409 naming the holder if another device has it.
+func (h *LeaseHandler) Acquire(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req acquireLeaseRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	lease, err := h.leaseService.Acquire(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r), ttl, req.Enforce)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lease)
+}
+
+// Renew extends the caller's lease: PUT /leases/{key} {"ttl_seconds": 30}
+func (h *LeaseHandler) Renew(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req renewLeaseRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	lease, err := h.leaseService.Renew(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r), ttl)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lease)
+}
+
+// Release gives up the caller's lease: DELETE /leases/{key}
+func (h *LeaseHandler) Release(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	if err := h.leaseService.Release(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// AuthMiddleware rejects requests without a valid bearer token and stores the
+// token claims in the request context for ClaimsFromContext.
+func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			claims, err := authService.Authenticate(r.Context(), token)
+			if err == services.ErrInvalidToken {
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClaimsFromContext returns the claims stored by AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) *services.TokenClaims {
+	claims, _ := ctx.Value(claimsContextKey).(*services.TokenClaims)
+	return claims
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type OpLogHandler struct {
+	opLogService *services.OpLogService
+}
+
+func NewOpLogHandler(opLogService *services.OpLogService) *OpLogHandler {
+	return &OpLogHandler{opLogService: opLogService}
+}
+
+// RegisterRoutes mounts the op log endpoints. Routes must be behind AuthMiddleware.
+// Op logs have their own key namespace, separate from states.
+func (h *OpLogHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/ops/*", h.Read)
+	r.Post("/ops/*", h.Append)
+	r.Put("/snapshots/*", h.PublishSnapshot)
+}
+
+type opRequest struct {
+	Op    []byte `json:"op"`
+	Nonce []byte `json:"nonce"`
+}
+
+type appendOpsRequest struct {
+	Ops []opRequest `json:"ops"`
+}
+
+type appendOpsResponse struct {
+	FirstPosition int64 `json:"first_position"`
+	LastPosition  int64 `json:"last_position"`
+}
+
+type publishSnapshotRequest struct {
+	Position int64  `json:"position"`
+	Snapshot []byte `json:"snapshot"`
+	Nonce    []byte `json:"nonce"`
+}
+
+// Read returns a page of a key's ops: GET /ops/{key}?after=N&limit=M
+func (h *OpLogHandler) Read(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	query := r.URL.Query()
+
+	var after int64
+	if raw := query.Get("after"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "after must be an integer")
+			return
+		}
+		after = parsed
+	}
+
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := h.opLogService.Read(r.Context(), claims.AccountID, stateKey(r), after, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Append adds ops to the end of a key's log and returns their positions.
+func (h *OpLogHandler) Append(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req appendOpsRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ops := make([]*models.StateOp, len(req.Ops))
+	for i, op := range req.Ops {
+		ops[i] = &models.StateOp{Op: op.Op, Nonce: op.Nonce}
+	}
+
+	if err := h.opLogService.Append(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r), ops); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, appendOpsResponse{
+		FirstPosition: ops[0].Position,
+		LastPosition:  ops[len(ops)-1].Position,
+	})
+}
+
+// PublishSnapshot stores a compacted snapshot of a key's log up to position,
+// after which the server drops the ops it covers.
+func (h *OpLogHandler) PublishSnapshot(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req publishSnapshotRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	snapshot := &models.OpSnapshot{
+		AccountID: claims.AccountID,
+		DeviceID:  claims.DeviceID,
+		Key:       stateKey(r),
+		Position:  req.Position,
+		Snapshot:  req.Snapshot,
+		Nonce:     req.Nonce,
+	}
+	if err := h.opLogService.PublishSnapshot(r.Context(), snapshot); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+// maxJSONBodySize bounds request bodies decoded by decodeJSON.
+const maxJSONBodySize = 8 << 20
+
+// errPreconditionFailed is returned when a conditional request's If-Match or
+// If-None-Match header does not hold.
+var errPreconditionFailed = errors.New("precondition failed: state does not match the given ETag")
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// writeServiceError maps errors returned by services and repositories to
+// HTTP responses. Unknown errors are logged and reported as 500.
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, errPreconditionFailed):
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, repositories.ErrVersionConflict),
+		errors.Is(err, repositories.ErrKeyRetired),
+		errors.Is(err, repositories.ErrLeaseHeld),
+		errors.Is(err, repositories.ErrLeaseNotHeld):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidStateKey),
+		errors.Is(err, services.ErrInvalidPrefix),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrInvalidExpiry),
+		errors.Is(err, services.ErrInvalidChunkHash),
+		errors.Is(err, services.ErrChunkHashMismatch),
+		errors.Is(err, services.ErrTooManyChunks),
+		errors.Is(err, services.ErrInvalidKeyID),
+		errors.Is(err, services.ErrInvalidEnvelope),
+		errors.Is(err, services.ErrInvalidShare),
+		errors.Is(err, services.ErrSharedChunks),
+		errors.Is(err, services.ErrInvalidOp),
+		errors.Is(err, services.ErrInvalidPosition),
+		errors.Is(err, services.ErrInvalidLeaseTTL),
+		errors.Is(err, services.ErrInvalidSequence),
+		errors.Is(err, services.ErrInvalidFilter),
+		errors.Is(err, repositories.ErrSequenceAhead),
+		errors.Is(err, repositories.ErrInvalidVisibility),
+		errors.Is(err, repositories.ErrSnapshotAhead):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrAccountExists),
+		errors.Is(err, repositories.ErrStaleSnapshot):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrMissingChunks):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrUndeleteExpired):
+		writeError(w, http.StatusGone, err.Error())
+	case errors.Is(err, repositories.ErrQuotaExceeded),
+		errors.Is(err, repositories.ErrAccessDenied):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrChunkTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, services.ErrTooManyWaiters):
+		writeError(w, http.StatusTooManyRequests, err.Error())
+	default:
+		log.Printf("internal error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
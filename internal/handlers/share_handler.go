@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type ShareHandler struct {
+	shareService *services.ShareService
+	syncService  *services.SyncService
+}
+
+func NewShareHandler(shareService *services.ShareService, syncService *services.SyncService) *ShareHandler {
+	return &ShareHandler{shareService: shareService, syncService: syncService}
+}
+
+// RegisterRoutes mounts the sharing endpoints. Routes must be behind AuthMiddleware.
+// Owners manage grants under /shares/{key}; grantees reach shared states
+// under /shared/{owner account ID}.
+func (h *ShareHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/shares/*", h.ListGrants)
+	r.Put("/shares/*", h.Grant)
+	r.Delete("/shares/*", h.Revoke)
+	r.Get("/shared", h.SharedWithMe)
+	r.Get("/shared/{owner}/states/*", h.GetShared)
+	r.Put("/shared/{owner}/states/*", h.PutShared)
+	r.Get("/shared/{owner}/chunks/{hash}", h.GetSharedChunk)
+}
+
+type grantShareRequest struct {
+	GranteeAccountID uuid.UUID  `json:"grantee_account_id"`
+	Permission       string     `json:"permission"`
+	WrappedKey       []byte     `json:"wrapped_key"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+}
+
+type sharesResponse struct {
+	Shares []*models.StateShare `json:"shares"`
+}
+
+// ListGrants returns the grants on one of the caller's states.
+func (h *ShareHandler) ListGrants(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	shares, err := h.shareService.ListGrants(r.Context(), claims.AccountID, stateKey(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sharesResponse{Shares: shares})
+}
+
+// Grant shares one of the caller's states with another account, or updates
+// the existing grant.
+func (h *ShareHandler) Grant(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req grantShareRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	share := &models.StateShare{
+		GranteeAccountID: req.GranteeAccountID,
+		Permission:       req.Permission,
+		WrappedKey:       req.WrappedKey,
+		ExpiresAt:        req.ExpiresAt,
+	}
+	if err := h.shareService.Grant(r.Context(), claims.AccountID, stateKey(r), share); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, share)
+}
+
+// Revoke removes a grant: DELETE /shares/{key}?grantee=<account ID>
+func (h *ShareHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	granteeID, err := uuid.Parse(r.URL.Query().Get("grantee"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "grantee must be an account ID")
+		return
+	}
+
+	if err := h.shareService.Revoke(r.Context(), claims.AccountID, stateKey(r), granteeID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SharedWithMe lists the states other accounts have shared with the caller.
+func (h *ShareHandler) SharedWithMe(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	shares, err := h.shareService.SharedWithMe(r.Context(), claims.AccountID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sharesResponse{Shares: shares})
+}
+
+// GetShared returns a state shared with the caller along with the caller's
+// wrapped content key.
+func (h *ShareHandler) GetShared(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	ownerID, err := uuid.Parse(chi.URLParam(r, "owner"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	shared, err := h.shareService.GetShared(r.Context(), claims.AccountID, ownerID, stateKey(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(shared.State))
+	writeJSON(w, http.StatusOK, shared)
+}
+
+// PutShared updates a state shared with the caller through a read-write
+// share. Version must be the version the client last saw.
+func (h *ShareHandler) PutShared(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	ownerID, err := uuid.Parse(chi.URLParam(r, "owner"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	var req putStateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.State == nil || req.Nonce == nil {
+		writeError(w, http.StatusBadRequest, "state and nonce are required")
+		return
+	}
+
+	state := &models.EncryptedState{
+		AccountID: ownerID,
+		DeviceID:  claims.DeviceID,
+		Key:       stateKey(r),
+		State:     req.State,
+		Nonce:     req.Nonce,
+		Chunks:    req.Chunks,
+		Version:   req.Version,
+		ExpiresAt: req.ExpiresAt,
+
+		EncryptionEnvelope: req.EncryptionEnvelope,
+	}
+	if err := h.syncService.PutAs(r.Context(), claims.AccountID, state); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(state))
+	writeJSON(w, http.StatusOK, state)
+}
+
+// GetSharedChunk returns a chunk of a chunked state shared with the caller.
+func (h *ShareHandler) GetSharedChunk(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	ownerID, err := uuid.Parse(chi.URLParam(r, "owner"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	chunk, err := h.shareService.GetSharedChunk(r.Context(), claims.AccountID, ownerID, chi.URLParam(r, "hash"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(chunk.Data)))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chunk.Data)
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+const (
+	// socketReadTimeout closes sockets that send nothing, not even a
+	// heartbeat, for this long. Clients should send a heartbeat every 30s.
+	socketReadTimeout = 90 * time.Second
+
+	// socketWriteTimeout bounds how long one message may take to send.
+	socketWriteTimeout = 10 * time.Second
+
+	// socketSessionCheckInterval is how often an idle socket checks that its
+	// session and device are still valid. Sockets also check before each send.
+	socketSessionCheckInterval = 15 * time.Second
+
+	// socketMaxMessageSize bounds the messages clients may send.
+	socketMaxMessageSize = 4 << 10
+)
+
+type SocketHandler struct {
+	authService   *services.AuthService
+	syncService   *services.SyncService
+	deviceService *services.DeviceService
+	upgrader      websocket.Upgrader
+}
+
+// NewSocketHandler creates a SocketHandler. Browsers may only open sockets
+// from the server's own origin or one of allowedOrigins, e.g.
+// "https://app.example.com".
+func NewSocketHandler(authService *services.AuthService, syncService *services.SyncService, deviceService *services.DeviceService, allowedOrigins []string) *SocketHandler {
+	return &SocketHandler{
+		authService:   authService,
+		syncService:   syncService,
+		deviceService: deviceService,
+		upgrader:      websocket.Upgrader{CheckOrigin: checkOrigin(allowedOrigins)},
+	}
+}
+
+// checkOrigin accepts requests from the server's own origin or one of
+// allowedOrigins. Requests without an Origin header come from native
+// clients, not browsers, and are accepted: they hold the bearer token
+// themselves.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if slices.ContainsFunc(allowedOrigins, func(allowed string) bool { return strings.EqualFold(allowed, origin) }) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// RegisterRoutes mounts the real-time sync endpoint. Routes must be behind AuthMiddleware.
+func (h *SocketHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/sync/socket", h.Socket)
+}
+
+// socketMessage is a message on a sync socket. The server sends "events"
+// with a page of events and the cursor after them, and "resync" when the
+// client must reload its states and continue from next. Clients send
+// "heartbeat".
+type socketMessage struct {
+	Type   string              `json:"type"`
+	Events []*models.SyncEvent `json:"events,omitempty"`
+	Next   int64               `json:"next,omitempty"`
+}
+
+const (
+	socketMessageEvents    = "events"
+	socketMessageResync    = "resync"
+	socketMessageHeartbeat = "heartbeat"
+)
+
+// Socket streams the caller's events over a WebSocket:
+// GET /sync/socket?since=N, with the same prefix and type filters as
+// GET /sync/events. The server first sends the backlog after since, then
+// each event as it is appended. Heartbeats from the client keep its device
+// online. The socket is closed when the session ends or the device is
+// revoked; nothing is sent once either has happened.
+func (h *SocketHandler) Socket(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	since, ok := sinceParam(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "since must be a non-negative integer")
+		return
+	}
+	filter := eventFilter(r)
+
+	// Watch before the first read, so events appended while the socket is
+	// being set up still wake it
+	waiter := h.syncService.Watch(claims.AccountID)
+	defer waiter.Release()
+	woken := waiter.Woken()
+
+	// Read the first page before upgrading, so a bad cursor or filter is an
+	// ordinary error response
+	page, err := h.syncService.Events(r.Context(), claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	// The request context isn't canceled when a hijacked connection closes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := h.deviceService.Heartbeat(ctx, claims.AccountID, claims.DeviceID); err != nil {
+		log.Printf("failed to mark device %s online: %v", claims.DeviceID, err)
+	}
+	defer func() {
+		if err := h.deviceService.Disconnect(context.Background(), claims.DeviceID); err != nil {
+			log.Printf("failed to mark device %s offline: %v", claims.DeviceID, err)
+		}
+	}()
+
+	closed := make(chan struct{})
+	go h.readHeartbeats(ctx, conn, claims, closed)
+
+	sessionCheck := time.NewTicker(socketSessionCheckInterval)
+	defer sessionCheck.Stop()
+
+	for {
+		// Send everything after since, a page at a time
+		for {
+			if page.ResyncRequired {
+				if !h.send(ctx, conn, claims, socketMessage{Type: socketMessageResync, Next: page.Next}) {
+					return
+				}
+			} else if len(page.Events) > 0 {
+				if !h.send(ctx, conn, claims, socketMessage{Type: socketMessageEvents, Events: page.Events, Next: page.Next}) {
+					return
+				}
+			}
+			since = page.Next
+			if !page.HasMore && !page.ResyncRequired {
+				break
+			}
+			if page, err = h.syncService.Events(ctx, claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize); err != nil {
+				closeSocket(conn, websocket.CloseInternalServerErr, "internal server error")
+				return
+			}
+		}
+
+	wait:
+		for {
+			select {
+			case <-woken:
+				break wait
+			case <-closed:
+				return
+			case <-sessionCheck.C:
+				if !h.checkSession(ctx, conn, claims) {
+					return
+				}
+			}
+		}
+
+		woken = waiter.Woken()
+		if page, err = h.syncService.Events(ctx, claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize); err != nil {
+			closeSocket(conn, websocket.CloseInternalServerErr, "internal server error")
+			return
+		}
+	}
+}
+
+// send writes msg if the session is still valid, reporting whether the
+// socket is still open.
+func (h *SocketHandler) send(ctx context.Context, conn *websocket.Conn, claims *services.TokenClaims, msg socketMessage) bool {
+	if !h.checkSession(ctx, conn, claims) {
+		return false
+	}
+	return writeSocketMessage(conn, msg) == nil
+}
+
+// checkSession closes the socket if the session has ended or the device has
+// been revoked, reporting whether it is still open. Errors looking them up
+// are logged and leave the socket open.
+func (h *SocketHandler) checkSession(ctx context.Context, conn *websocket.Conn, claims *services.TokenClaims) bool {
+	err := h.authService.CheckSession(ctx, claims)
+	if errors.Is(err, services.ErrInvalidToken) {
+		closeSocket(conn, websocket.ClosePolicyViolation, "session revoked")
+		return false
+	}
+	if err != nil {
+		log.Printf("failed to check session of device %s: %v", claims.DeviceID, err)
+	}
+	return true
+}
+
+// readHeartbeats reads client messages until the socket fails or goes quiet
+// for socketReadTimeout, then closes closed.
+func (h *SocketHandler) readHeartbeats(ctx context.Context, conn *websocket.Conn, claims *services.TokenClaims, closed chan<- struct{}) {
+	defer close(closed)
+
+	conn.SetReadLimit(socketMaxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+
+		var msg socketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != socketMessageHeartbeat {
+			continue
+		}
+		if err := h.deviceService.Heartbeat(ctx, claims.AccountID, claims.DeviceID); err != nil {
+			log.Printf("failed to record heartbeat of device %s: %v", claims.DeviceID, err)
+		}
+	}
+}
+
+func writeSocketMessage(conn *websocket.Conn, msg socketMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// closeSocket tells the client why the socket is closing. The connection
+// itself is closed by the caller.
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteTimeout))
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type StateHandler struct {
+	stateService *services.StateService
+	syncService  *services.SyncService
+}
+
+func NewStateHandler(stateService *services.StateService, syncService *services.SyncService) *StateHandler {
+	return &StateHandler{stateService: stateService, syncService: syncService}
+}
+
+// RegisterRoutes mounts the state endpoints. Routes must be behind AuthMiddleware.
+// The key is the rest of the path, so keys may contain slashes.
+func (h *StateHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/manifest", h.Manifest)
+	r.Get("/states", h.List)
+	r.Get("/states/*", h.Get)
+	r.Put("/states/*", h.Put)
+	r.Delete("/states/*", h.Delete)
+	r.Post("/undelete/*", h.Undelete)
+}
+
+type putStateRequest struct {
+	State     []byte      `json:"state"`
+	Nonce     []byte      `json:"nonce"`
+	Chunks    []string    `json:"chunks,omitempty"`
+	VisibleTo []uuid.UUID `json:"visible_to,omitempty"`
+	Version   int64       `json:"version"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	models.EncryptionEnvelope
+}
+
+// List pages through the caller's states by key prefix:
+// GET /states?prefix=notes/&limit=50&cursor=<next_cursor from the previous page>
+func (h *StateHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	query := r.URL.Query()
+
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := h.stateService.List(r.Context(), claims.AccountID, claims.DeviceID, query.Get("prefix"), query.Get("cursor"), limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+type manifestResponse struct {
+	Entries []*models.StateManifestEntry `json:"entries"`
+}
+
+// Manifest returns metadata for all of the caller's states, optionally under
+// a key prefix: GET /manifest?prefix=notes/
+func (h *StateHandler) Manifest(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	entries, err := h.stateService.Manifest(r.Context(), claims.AccountID, claims.DeviceID, r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, manifestResponse{Entries: entries})
+}
+
+// Get returns a state with its version and content hash as the ETag. A
+// request whose If-None-Match matches gets 304 Not Modified without a body.
+func (h *StateHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	state, err := h.stateService.Get(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(state))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, state, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+// Put creates or updates a state. Version must be the version the client last
+// saw (0 for a new key); a stale version is rejected with 409. Instead of a
+// version, clients may send If-Match with the ETag they last saw, or
+// If-None-Match: * to only create; these fail with 412.
+func (h *StateHandler) Put(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req putStateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Nonce == nil || (req.State == nil && len(req.Chunks) == 0) {
+		writeError(w, http.StatusBadRequest, "state or chunks, and nonce are required")
+		return
+	}
+
+	version, conditional, err := h.expectedVersion(r, claims.AccountID, claims.DeviceID, req.Version)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	state := &models.EncryptedState{
+		AccountID: claims.AccountID,
+		DeviceID:  claims.DeviceID,
+		Key:       stateKey(r),
+		State:     req.State,
+		Nonce:     req.Nonce,
+		Chunks:    req.Chunks,
+		VisibleTo: req.VisibleTo,
+		Version:   version,
+		ExpiresAt: req.ExpiresAt,
+
+		EncryptionEnvelope: req.EncryptionEnvelope,
+	}
+	err = h.syncService.Put(r.Context(), state)
+	if conditional && errors.Is(err, repositories.ErrVersionConflict) {
+		err = errPreconditionFailed
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(state))
+	writeJSON(w, http.StatusOK, state)
+}
+
+type undeleteRequest struct {
+	Version int64 `json:"version"`
+}
+
+// Delete removes a state: DELETE /states/{key}?version=N, where N is the
+// version the client last saw, or with If-Match instead of the version.
+// The response is the tombstone.
+func (h *StateHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var version int64
+	if raw := r.URL.Query().Get("version"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "version must be a positive integer")
+			return
+		}
+		version = parsed
+	}
+
+	version, conditional, err := h.expectedVersion(r, claims.AccountID, claims.DeviceID, version)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if version == 0 {
+		writeError(w, http.StatusBadRequest, "version or If-Match is required")
+		return
+	}
+
+	tombstone, err := h.syncService.Delete(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r), version)
+	if conditional && errors.Is(err, repositories.ErrVersionConflict) {
+		err = errPreconditionFailed
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tombstone)
+}
+
+// Undelete restores a deleted state within the retention window. The body
+// carries the tombstone's version.
+func (h *StateHandler) Undelete(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req undeleteRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	state, err := h.syncService.Undelete(r.Context(), claims.AccountID, claims.DeviceID, stateKey(r), req.Version)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+// expectedVersion resolves the version a write expects from its conditional
+// headers, falling back to the version the client sent. With If-Match the
+// current state must match one of the tags and its version is used; with
+// If-None-Match: * the key must not exist yet (version 0). conditional reports
+// whether a header was used, so version conflicts can be reported as 412.
+func (h *StateHandler) expectedVersion(r *http.Request, accountID, deviceID uuid.UUID, fallback int64) (version int64, conditional bool, err error) {
+	if r.Header.Get("If-None-Match") == "*" {
+		return 0, true, nil
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return fallback, false, nil
+	}
+
+	current, err := h.stateService.Get(r.Context(), accountID, deviceID, stateKey(r))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return 0, true, errPreconditionFailed
+	}
+	if err != nil {
+		return 0, true, err
+	}
+	if !etagMatches(ifMatch, current, false) {
+		return 0, true, errPreconditionFailed
+	}
+	return current.Version, true, nil
+}
+
+func stateKey(r *http.Request) string {
+	return chi.URLParam(r, "*")
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+const (
+	// streamKeepaliveInterval is how often an idle event stream sends a
+	// comment to keep proxies from closing it. Each keepalive also checks
+	// that the stream's session and device are still valid, as does each send.
+	streamKeepaliveInterval = 15 * time.Second
+
+	// streamRetryDelay is how long clients are told to wait before
+	// reconnecting to a stream that failed.
+	streamRetryDelay = 5 * time.Second
+)
+
+type SyncHandler struct {
+	syncService       *services.SyncService
+	authService       *services.AuthService
+	keepaliveInterval time.Duration
+}
+
+func NewSyncHandler(syncService *services.SyncService, authService *services.AuthService) *SyncHandler {
+	return &SyncHandler{syncService: syncService, authService: authService, keepaliveInterval: streamKeepaliveInterval}
+}
+
+// RegisterRoutes mounts the event stream endpoints. Routes must be behind AuthMiddleware.
+func (h *SyncHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/sync/events", h.Events)
+	r.Get("/sync/stream", h.Stream)
+	r.Post("/sync/ack", h.Ack)
+}
+
+type ackRequest struct {
+	Sequence int64 `json:"sequence"`
+}
+
+// Events returns a page of the caller's events after a sequence number:
+// GET /sync/events?since=N&limit=M. Repeated prefix and type parameters
+// narrow the page to those key prefixes and event types, e.g.
+// &prefix=photos/&type=delete. Clients pass the response's next as
+// since until has_more is false. When resync_required is set, the events
+// after since were compacted: the client reloads its states and continues
+// from next. With wait=S, a request that finds no events waits up to S
+// seconds (at most a minute) for the next ones before returning an empty page.
+func (h *SyncHandler) Events(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	query := r.URL.Query()
+
+	since, ok := sinceParam(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "since must be a non-negative integer")
+		return
+	}
+
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	var wait time.Duration
+	if raw := query.Get("wait"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "wait must be a non-negative number of seconds")
+			return
+		}
+		wait = time.Duration(parsed) * time.Second
+	}
+
+	page, err := h.syncService.WaitEvents(r.Context(), claims.AccountID, claims.DeviceID, since, eventFilter(r), limit, wait)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Stream sends the caller's events as Server-Sent Events:
+// GET /sync/stream?since=N, with the same prefix and type filters as
+// GET /sync/events. Each event is a message whose data is the event's JSON
+// and whose id is its sequence number, so a reconnecting client resumes
+// after the last event it received through Last-Event-ID, which takes
+// precedence over since. A "resync" event means the client must reload its
+// states; its id is the sequence number to continue from. Idle streams get
+// a keepalive comment every 15 seconds. A stream that fails ends with an
+// "error" event and a retry delay, after which the client reconnects.
+func (h *SyncHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	since, ok := sinceParam(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "since must be a non-negative integer")
+		return
+	}
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "Last-Event-ID must be a non-negative integer")
+			return
+		}
+		since = parsed
+	}
+	filter := eventFilter(r)
+
+	// Watch before the first read, so events appended in between still
+	// wake the stream
+	waiter := h.syncService.Watch(claims.AccountID)
+	defer waiter.Release()
+	woken := waiter.Woken()
+
+	// Read the first page before writing headers, so a bad cursor or filter
+	// is an ordinary error response
+	page, err := h.syncService.Events(r.Context(), claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("event stream can't be flushed: %v", err)
+		return
+	}
+
+	keepalive := time.NewTicker(h.keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		// Send everything after since, a page at a time
+		for {
+			if page.ResyncRequired || len(page.Events) > 0 {
+				if !h.checkSession(r, claims) {
+					return
+				}
+			}
+			if err := writeStreamPage(w, page); err != nil {
+				return
+			}
+			since = page.Next
+			if !page.HasMore && !page.ResyncRequired {
+				break
+			}
+			if page, err = h.syncService.Events(r.Context(), claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize); err != nil {
+				failStream(w, rc, r, claims, err)
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+	wait:
+		for {
+			select {
+			case <-woken:
+				break wait
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				if !h.checkSession(r, claims) {
+					return
+				}
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+
+		woken = waiter.Woken()
+		if page, err = h.syncService.Events(r.Context(), claims.AccountID, claims.DeviceID, since, filter, services.MaxPageSize); err != nil {
+			failStream(w, rc, r, claims, err)
+			return
+		}
+	}
+}
+
+// checkSession reports whether the stream's session and device are still
+// valid. Errors looking them up are logged and keep the stream open.
+func (h *SyncHandler) checkSession(r *http.Request, claims *services.TokenClaims) bool {
+	err := h.authService.CheckSession(r.Context(), claims)
+	if errors.Is(err, services.ErrInvalidToken) {
+		return false
+	}
+	if err != nil {
+		log.Printf("failed to check session of device %s: %v", claims.DeviceID, err)
+	}
+	return true
+}
+
+// failStream ends a stream whose events can't be read: it logs err and sends
+// a final "error" event telling the client to reconnect after
+// streamRetryDelay, resuming through Last-Event-ID.
+func failStream(w http.ResponseWriter, rc *http.ResponseController, r *http.Request, claims *services.TokenClaims, err error) {
+	if r.Context().Err() != nil {
+		// The client is gone
+		return
+	}
+	log.Printf("event stream of device %s failed: %v", claims.DeviceID, err)
+
+	fmt.Fprintf(w, "retry: %d\nevent: error\ndata: {\"error\":\"internal server error\"}\n\n", streamRetryDelay.Milliseconds())
+	rc.Flush()
+}
+
+// writeStreamPage writes a page of events as Server-Sent Events.
+func writeStreamPage(w http.ResponseWriter, page *services.EventPage) error {
+	if page.ResyncRequired {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {\"next\":%d}\n\n", page.Next, page.Next)
+		return err
+	}
+	for _, event := range page.Events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.SequenceNumber, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ack records the highest sequence number the caller's device has applied:
+// POST /sync/ack {"sequence": N}. The cursor drives the lag reported by GET /devices.
+func (h *SyncHandler) Ack(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	var req ackRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.syncService.Ack(r.Context(), claims.AccountID, claims.DeviceID, req.Sequence); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sinceParam reads the since query parameter of an event request, 0 if absent.
+func sinceParam(r *http.Request) (int64, bool) {
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		return 0, true
+	}
+	since, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || since < 0 {
+		return 0, false
+	}
+	return since, true
+}
+
+// eventFilter reads the prefix and type query parameters of an event request.
+func eventFilter(r *http.Request) models.EventFilter {
+	query := r.URL.Query()
+	return models.EventFilter{Prefixes: query["prefix"], EventTypes: query["type"]}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStreamPage(t *testing.T) {
+	eventID := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		page *services.EventPage
+		want string
+	}{
+		{
+			name: "empty page",
+			page: &services.EventPage{Events: []*models.SyncEvent{}, Next: 4},
+			want: "",
+		},
+		{
+			name: "one message per event, with its sequence number as id",
+			page: &services.EventPage{Events: []*models.SyncEvent{
+				{ID: eventID, SequenceNumber: 5, EventType: models.EventTypeUpdate, StateKey: "a", CreatedAt: created},
+				{ID: eventID, SequenceNumber: 7, EventType: models.EventTypeDelete, StateKey: "b", CreatedAt: created},
+			}, Next: 7},
+			want: "id: 5\ndata: " + mustJSON(t, &models.SyncEvent{ID: eventID, SequenceNumber: 5, EventType: models.EventTypeUpdate, StateKey: "a", CreatedAt: created}) + "\n\n" +
+				"id: 7\ndata: " + mustJSON(t, &models.SyncEvent{ID: eventID, SequenceNumber: 7, EventType: models.EventTypeDelete, StateKey: "b", CreatedAt: created}) + "\n\n",
+		},
+		{
+			name: "resync names where to continue",
+			page: &services.EventPage{Events: []*models.SyncEvent{}, Next: 9, ResyncRequired: true},
+			want: "id: 9\nevent: resync\ndata: {\"next\":9}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			require.NoError(t, writeStreamPage(w, tt.page))
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func TestFailStream(t *testing.T) {
+	claims := &services.TokenClaims{DeviceID: uuid.New()}
+
+	// A failure is reported to the client with a retry delay
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/sync/stream", nil)
+	failStream(w, http.NewResponseController(w), r, claims, errors.New("database is down"))
+	assert.Equal(t, "retry: 5000\nevent: error\ndata: {\"error\":\"internal server error\"}\n\n", w.Body.String())
+	assert.NotContains(t, w.Body.String(), "database is down", "Internal errors aren't exposed")
+
+	// Nothing is written once the client is gone
+	w = httptest.NewRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	failStream(w, http.NewResponseController(w), r.WithContext(ctx), claims, ctx.Err())
+	assert.Empty(t, w.Body.String())
+}
+
+// TestStream_LastEventIDOverridesSince tests that a reconnecting client resumes after its Last-Event-ID
+func TestStream_LastEventIDOverridesSince(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	login := srv.login(t, ctx)
+
+	for _, key := range []string{"notes/a", "notes/b", "notes/c"} {
+		srv.put(t, ctx, login, key)
+	}
+
+	// ACT: Reconnect after event 2 with a stale since
+	stream := srv.openStream(t, login, "since=0", "2")
+
+	// ASSERT: The stream starts after event 2
+	frame := stream.message(t)
+	assert.True(t, strings.HasPrefix(frame, "id: 3\ndata: "), "Unexpected frame %q", frame)
+	assert.Contains(t, frame, `"state_key":"notes/c"`)
+}
+
+// TestStream_Resync tests that a client behind the compaction horizon is told to resync
+func TestStream_Resync(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	login := srv.login(t, ctx)
+
+	srv.put(t, ctx, login, "notes/a")
+	srv.put(t, ctx, login, "notes/b")
+	_, err := srv.pool.Exec(ctx, `UPDATE sync_sequences SET compacted_through = 2 WHERE account_id = $1`, login.AccountID)
+	require.NoError(t, err)
+
+	// ACT: Stream from before the horizon
+	stream := srv.openStream(t, login, "since=1", "")
+
+	// ASSERT: A resync event to continue from the horizon, then live events after it
+	assert.Equal(t, "id: 2\nevent: resync\ndata: {\"next\":2}", stream.message(t))
+
+	srv.put(t, ctx, login, "notes/c")
+	frame := stream.message(t)
+	assert.True(t, strings.HasPrefix(frame, "id: 3\ndata: "), "Unexpected frame %q", frame)
+}
+
+// TestStream_Keepalive tests that an idle stream sends keepalive comments
+func TestStream_Keepalive(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	login := srv.login(t, ctx)
+
+	stream := srv.openStream(t, login, "", "")
+
+	assert.Equal(t, ": keepalive", stream.next(t))
+	assert.Equal(t, ": keepalive", stream.next(t))
+}
+
+func mustJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// testStream reads the frames of an event stream.
+type testStream struct {
+	reader *bufio.Reader
+}
+
+// openStream opens an event stream as the logged in device with the given
+// query and, if not empty, Last-Event-ID
+func (s *testServer) openStream(t *testing.T, login *services.LoginResponse, query, lastEventID string) *testStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/sync/stream?"+query, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return &testStream{reader: bufio.NewReader(resp.Body)}
+}
+
+// message returns the next frame that isn't a keepalive
+func (s *testStream) message(t *testing.T) string {
+	for {
+		if frame := s.next(t); !strings.HasPrefix(frame, ":") {
+			return frame
+		}
+	}
+}
+
+// next returns the next frame without its terminating blank line
+func (s *testStream) next(t *testing.T) string {
+	frames := make(chan string, 1)
+	go func() {
+		var lines []string
+		for {
+			line, err := s.reader.ReadString('\n')
+			if err != nil {
+				close(frames)
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				frames <- strings.Join(lines, "\n")
+				return
+			}
+			lines = append(lines, line)
+		}
+	}()
+
+	select {
+	case frame, ok := <-frames:
+		require.True(t, ok, "Stream ended")
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a frame")
+		return ""
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prudhvinik1/edgesync/internal/services"
+)
+
+type UsageHandler struct {
+	quotaService *services.QuotaService
+}
+
+func NewUsageHandler(quotaService *services.QuotaService) *UsageHandler {
+	return &UsageHandler{quotaService: quotaService}
+}
+
+// RegisterRoutes mounts the usage endpoint. Routes must be behind AuthMiddleware.
+func (h *UsageHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/usage", h.Get)
+}
+
+// Get returns the caller's storage usage against the account's quota limits.
+func (h *UsageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+
+	report, err := h.quotaService.GetUsage(r.Context(), claims.AccountID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
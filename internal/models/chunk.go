@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chunk is a piece of an encrypted state payload, addressed by the SHA-256
+// hash of its ciphertext. Chunks are scoped to an account and shared between
+// every state version that references them.
+type Chunk struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Hash      string    `json:"hash"`
+	Size      int       `json:"size"`
+	Data      []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	TouchedAt time.Time `json:"touched_at"`
+}
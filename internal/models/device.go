@@ -17,5 +17,16 @@ type Device struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	SyncedSequence int64 `json:"synced_sequence"` // Highest event sequence the device has acknowledged
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+}
+
+// DeviceStatus is a device with how far it lags behind its account's event
+// stream: the events it may receive that it hasn't acknowledged, and how
+// long the oldest of them has been waiting.
+type DeviceStatus struct {
+	*Device
+	EventsBehind int64 `json:"events_behind"`
+	SecondsBehind int64 `json:"seconds_behind"`
 }
 
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,8 +14,24 @@ type EncryptedState struct {
 	Key string `json:"key"`
 	State []byte `json:"state"`
 	Nonce []byte `json:"nonce"`
+	Chunks []string `json:"chunks,omitempty"` // Ordered chunk hashes; State is empty when set
+	VisibleTo []uuid.UUID `json:"visible_to,omitempty"` // Devices that may read the state; nil means all of the account's devices
+	EncryptionEnvelope
 	Version int64 `json:"version"`
+	Size int64 `json:"size"`
+	ContentHash string `json:"content_hash"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// BlobKey names the blob holding State when it was too large to store
+	// inline; BlobSize is its length. Both are internal to the repository.
+	BlobKey string `json:"-"`
+	BlobSize int64 `json:"-"`
+}
+
+// VisibleToDevice reports whether deviceID may read the state.
+func (s *EncryptedState) VisibleToDevice(deviceID uuid.UUID) bool {
+	return s.VisibleTo == nil || slices.Contains(s.VisibleTo, deviceID)
 }
\ No newline at end of file
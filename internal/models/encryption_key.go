@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EncryptionEnvelope is the plaintext description of how a client encrypted
+// a state. The server stores it as-is and never sees the keys themselves.
+type EncryptionEnvelope struct {
+	CipherSuite   string `json:"cipher_suite,omitempty"`
+	KeyID         string `json:"key_id,omitempty"`
+	KeyGeneration int    `json:"key_generation,omitempty"`
+	FormatVersion int    `json:"format_version,omitempty"`
+}
+
+// RetiredKey marks a client key ID that may no longer be used for writes.
+type RetiredKey struct {
+	AccountID uuid.UUID `json:"account_id"`
+	KeyID     string    `json:"key_id"`
+	RetiredAt time.Time `json:"retired_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lease is an advisory, time-limited claim by one device on a state key,
+// telling other devices that it is being edited. An enforced lease also
+// makes the server reject writes to the key from other devices until it
+// expires or is released.
+type Lease struct {
+	AccountID  uuid.UUID `json:"account_id"`
+	Key        string    `json:"key"`
+	DeviceID   uuid.UUID `json:"device_id"`
+	Enforced   bool      `json:"enforced"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StateOp is one encrypted CRDT operation in a key's op log. Position is
+// assigned by the server and totally orders the ops of a key.
+type StateOp struct {
+	AccountID uuid.UUID `json:"account_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	Key       string    `json:"key"`
+	Position  int64     `json:"position"`
+	Op        []byte    `json:"op"`
+	Nonce     []byte    `json:"nonce"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpSnapshot is a compacted encrypted state equivalent to applying every op
+// up to and including Position.
+type OpSnapshot struct {
+	AccountID uuid.UUID `json:"account_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	Key       string    `json:"key"`
+	Position  int64     `json:"position"`
+	Snapshot  []byte    `json:"snapshot"`
+	Nonce     []byte    `json:"nonce"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpLogHead summarizes a key's op log: the last assigned position and the
+// position of the latest snapshot (0 if none).
+type OpLogHead struct {
+	Key              string `json:"key"`
+	Position         int64  `json:"position"`
+	SnapshotPosition int64  `json:"snapshot_position"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QuotaLimits bounds what an account may store. A zero limit means unlimited.
+type QuotaLimits struct {
+	MaxBytes        int64 `json:"max_bytes"`
+	MaxKeys         int64 `json:"max_keys"`
+	MaxBlobSize     int64 `json:"max_blob_size"`
+	MaxEventsPerDay int64 `json:"max_events_per_day"`
+}
+
+type AccountUsage struct {
+	AccountID   uuid.UUID  `json:"account_id"`
+	BytesUsed   int64      `json:"bytes_used"`
+	KeyCount    int64      `json:"key_count"`
+	EventsToday int64      `json:"events_today"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StateManifestEntry describes a state without its ciphertext, so devices can
+// diff against their local cache and only download what changed.
+type StateManifestEntry struct {
+	Key         string    `json:"key"`
+	Version     int64     `json:"version"`
+	Size        int64     `json:"size"`
+	ContentHash string    `json:"content_hash"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	DeviceID    uuid.UUID `json:"device_id"`
+	EncryptionEnvelope
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Share permissions
+const (
+	SharePermissionRead      = "read"
+	SharePermissionReadWrite = "read_write"
+)
+
+// StateShare grants another account access to one encrypted state. The owner
+// wraps the state's content key for the grantee; the server only stores it.
+type StateShare struct {
+	ID               uuid.UUID  `json:"id"`
+	StateID          uuid.UUID  `json:"state_id"`
+	OwnerAccountID   uuid.UUID  `json:"owner_account_id"`
+	GranteeAccountID uuid.UUID  `json:"grantee_account_id"`
+	StateKey         string     `json:"state_key"`
+	Permission       string     `json:"permission"`
+	WrappedKey       []byte     `json:"wrapped_key"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// CanWrite reports whether the share allows the grantee to write the state.
+func (s *StateShare) CanWrite() bool {
+	return s.Permission == SharePermissionReadWrite
+}
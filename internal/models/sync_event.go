@@ -6,13 +6,38 @@ import (
 	"github.com/google/uuid"
 )
 
+// Event types for changes to encrypted states
+const (
+	EventTypeCreate = "create"
+	EventTypeUpdate = "update"
+	EventTypeDelete = "delete"
+
+	// Sent to a grantee when a state is shared with or unshared from them
+	EventTypeShare   = "share"
+	EventTypeUnshare = "unshare"
+
+	// Ops were appended to a key's op log; StateVersion is the last position
+	EventTypeOps = "ops"
+)
+
+// EventFilter narrows an event stream to events whose state key starts with
+// one of Prefixes and whose type is one of EventTypes. An empty list matches
+// everything.
+type EventFilter struct {
+	Prefixes   []string `json:"prefixes,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+}
+
 type SyncEvent struct {
 	ID uuid.UUID `json:"id"`
 	AccountID uuid.UUID `json:"account_id"`
+	OwnerAccountID *uuid.UUID `json:"owner_account_id,omitempty"` // Set when the state belongs to another account
 	DeviceID uuid.UUID `json:"device_id"`
 	EventType string `json:"event_type"`
 	StateKey string `json:"state_key"`
+	StateVersion int64 `json:"state_version,omitempty"`
 	SequenceNumber int64 `json:"sequence_number"`
 	Payload []byte `json:"payload"`
+	VisibleTo []uuid.UUID `json:"visible_to,omitempty"` // Copied from a device-scoped state; only these devices receive the event
 	CreatedAt time.Time `json:"created_at"`
 }
\ No newline at end of file
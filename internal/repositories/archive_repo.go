@@ -0,0 +1,527 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/prudhvinik1/edgesync/internal/blobstore"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// ErrAccountExists is returned when an import would reuse an existing account's email
+var ErrAccountExists = errors.New("an account with this email already exists")
+
+// PostgresArchiveRepository moves whole accounts in and out of portable
+// archives (see package archive). Shares are not exported, since they refer
+// to accounts that don't exist on the destination server.
+type PostgresArchiveRepository struct {
+	pool  *pgxpool.Pool
+	blobs blobstore.BlobStore
+}
+
+func NewPostgresArchiveRepository(pool *pgxpool.Pool) *PostgresArchiveRepository {
+	return &PostgresArchiveRepository{pool: pool}
+}
+
+// WithBlobStore lets Export read state content that was offloaded to blobs.
+// Imported states are always stored inline.
+func (r *PostgresArchiveRepository) WithBlobStore(blobs blobstore.BlobStore) *PostgresArchiveRepository {
+	r.blobs = blobs
+	return r
+}
+
+// Export adds every record the account owns to w, read from one consistent
+// snapshot. The password hash is only included with includeCredentials.
+// The caller finishes the archive.
+func (r *PostgresArchiveRepository) Export(ctx context.Context, accountID uuid.UUID, w *archive.Writer, includeCredentials bool) error {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var account archive.Account
+	err = tx.QueryRow(ctx, `SELECT id, email, password_hash, created_at FROM accounts WHERE id = $1 AND deleted_at IS NULL`, accountID).
+		Scan(&account.ID, &account.Email, &account.PasswordHash, &account.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	if !includeCredentials {
+		account.PasswordHash = ""
+	}
+	if err := w.Add(archive.FileAccount, account); err != nil {
+		return err
+	}
+
+	exports := []struct {
+		file  string
+		query string
+		scan  func(pgx.Rows) (any, error)
+	}{
+		{
+			archive.FileDevices,
+			`SELECT id, name, COALESCE(device_type, ''), public_key, last_seen_at, revoked_at, created_at
+			 FROM devices WHERE account_id = $1 AND deleted_at IS NULL ORDER BY created_at`,
+			func(rows pgx.Rows) (any, error) {
+				var d archive.Device
+				err := rows.Scan(&d.ID, &d.Name, &d.DeviceType, &d.PublicKey, &d.LastSeenAt, &d.RevokedAt, &d.CreatedAt)
+				return d, err
+			},
+		},
+		{
+			archive.FileChunks,
+			`SELECT hash, data, created_at FROM chunks WHERE account_id = $1 ORDER BY hash`,
+			func(rows pgx.Rows) (any, error) {
+				var c archive.Chunk
+				err := rows.Scan(&c.Hash, &c.Data, &c.CreatedAt)
+				return c, err
+			},
+		},
+		{
+			// Tombstones are kept so the destination continues each key's version sequence
+			archive.FileStates,
+			`SELECT ` + stateColumns + ` FROM encrypted_states WHERE account_id = $1 ORDER BY key COLLATE "C"`,
+			func(rows pgx.Rows) (any, error) {
+				state, err := scanState(rows)
+				if err != nil {
+					return nil, err
+				}
+				return state, loadStateBlob(ctx, r.blobs, state)
+			},
+		},
+		{
+			archive.FileOpLogs,
+			`SELECT key, position, snapshot_position, snapshot, snapshot_nonce, snapshot_device_id, snapshot_at, created_at
+			 FROM op_log_heads WHERE account_id = $1 ORDER BY key COLLATE "C"`,
+			func(rows pgx.Rows) (any, error) {
+				var l archive.OpLog
+				err := rows.Scan(&l.Key, &l.Position, &l.SnapshotPosition, &l.Snapshot, &l.SnapshotNonce,
+					&l.SnapshotDeviceID, &l.SnapshotAt, &l.CreatedAt)
+				return l, err
+			},
+		},
+		{
+			archive.FileOps,
+			`SELECT key, position, device_id, op, nonce, created_at
+			 FROM state_ops WHERE account_id = $1 ORDER BY key COLLATE "C", position`,
+			func(rows pgx.Rows) (any, error) {
+				var op models.StateOp
+				var deviceID *uuid.UUID
+				err := rows.Scan(&op.Key, &op.Position, &deviceID, &op.Op, &op.Nonce, &op.CreatedAt)
+				if deviceID != nil {
+					op.DeviceID = *deviceID
+				}
+				return op, err
+			},
+		},
+		{
+			archive.FileEvents,
+			`SELECT ` + eventColumns + ` FROM sync_events
+			 WHERE account_id = $1 AND owner_account_id IS NULL ORDER BY sequence_number`,
+			func(rows pgx.Rows) (any, error) { return scanEvent(rows) },
+		},
+		{
+			archive.FileRetiredKeys,
+			`SELECT account_id, key_id, retired_at FROM retired_keys WHERE account_id = $1 ORDER BY retired_at`,
+			func(rows pgx.Rows) (any, error) {
+				var k models.RetiredKey
+				err := rows.Scan(&k.AccountID, &k.KeyID, &k.RetiredAt)
+				return k, err
+			},
+		},
+	}
+
+	for _, export := range exports {
+		if err := exportRows(ctx, tx, w, export.file, export.query, accountID, export.scan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportRows(ctx context.Context, tx pgx.Tx, w *archive.Writer, file, query string, accountID uuid.UUID, scan func(pgx.Rows) (any, error)) error {
+	rows, err := tx.Query(ctx, query, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", file, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", file, err)
+		}
+		if err := w.Add(file, record); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s: %w", file, err)
+	}
+	return nil
+}
+
+// Import recreates an archived account in one transaction. Every record gets
+// a new ID and references are remapped; email, if set, replaces the
+// archived address. Quotas are not enforced, but usage is recomputed so the
+// account is charged for what was imported.
+func (r *PostgresArchiveRepository) Import(ctx context.Context, ar *archive.Reader, email string) (*models.Account, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	imp := &importer{
+		tx:      tx,
+		devices: make(map[uuid.UUID]uuid.UUID),
+		chunks:  make(map[string]int64),
+		opLogs:  make(map[string]*archive.OpLog),
+	}
+	for {
+		file, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if file != archive.FileAccount && imp.account == nil {
+			return nil, fmt.Errorf("%w: %s before account", archive.ErrInvalidArchive, file)
+		}
+
+		for {
+			var err error
+			switch file {
+			case archive.FileAccount:
+				err = decodeAndImport(ar, func(a *archive.Account) error { return imp.createAccount(ctx, a, email) })
+			case archive.FileDevices:
+				err = decodeAndImport(ar, func(d *archive.Device) error { return imp.device(ctx, d) })
+			case archive.FileChunks:
+				err = decodeAndImport(ar, func(c *archive.Chunk) error { return imp.chunk(ctx, c) })
+			case archive.FileStates:
+				err = decodeAndImport(ar, func(s *models.EncryptedState) error { return imp.state(ctx, s) })
+			case archive.FileOpLogs:
+				err = decodeAndImport(ar, func(l *archive.OpLog) error { return imp.opLog(ctx, l) })
+			case archive.FileOps:
+				err = decodeAndImport(ar, func(op *models.StateOp) error { return imp.op(ctx, op) })
+			case archive.FileEvents:
+				err = decodeAndImport(ar, func(e *models.SyncEvent) error { return imp.event(ctx, e) })
+			case archive.FileRetiredKeys:
+				err = decodeAndImport(ar, func(k *models.RetiredKey) error { return imp.retiredKey(ctx, k) })
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if imp.account == nil {
+		return nil, fmt.Errorf("%w: no account", archive.ErrInvalidArchive)
+	}
+
+	query := `INSERT INTO account_usage (account_id, bytes_used, key_count)
+	          SELECT $1,
+	                 COALESCE((SELECT SUM(octet_length(s.state) + octet_length(s.nonce))
+	                           FROM encrypted_states s
+	                           WHERE s.account_id = $1 AND s.deleted_at IS NULL), 0)
+	               + COALESCE((SELECT SUM(c.size) FROM chunks c WHERE c.account_id = $1), 0)
+	               + COALESCE((SELECT SUM(octet_length(o.op) + octet_length(o.nonce))
+	                           FROM state_ops o WHERE o.account_id = $1), 0)
+	               + COALESCE((SELECT SUM(octet_length(h.snapshot) + octet_length(h.snapshot_nonce))
+	                           FROM op_log_heads h WHERE h.account_id = $1), 0),
+	                 (SELECT COUNT(*) FROM encrypted_states s WHERE s.account_id = $1 AND s.deleted_at IS NULL)`
+	if _, err := tx.Exec(ctx, query, imp.account.ID); err != nil {
+		return nil, fmt.Errorf("failed to compute usage: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return imp.account, nil
+}
+
+// decodeAndImport decodes one record of type T and passes it to fn. It
+// returns io.EOF at the end of the current file.
+func decodeAndImport[T any](ar *archive.Reader, fn func(*T) error) error {
+	var record T
+	if err := ar.Decode(&record); err != nil {
+		return err
+	}
+	return fn(&record)
+}
+
+// importer holds the ID mappings of an import in progress.
+type importer struct {
+	tx      pgx.Tx
+	account *models.Account
+	devices map[uuid.UUID]uuid.UUID // archived ID -> new ID
+	chunks  map[string]int64        // imported chunk hash -> size
+	opLogs  map[string]*archive.OpLog
+}
+
+func (imp *importer) createAccount(ctx context.Context, a *archive.Account, email string) error {
+	if imp.account != nil {
+		return fmt.Errorf("%w: more than one account", archive.ErrInvalidArchive)
+	}
+	account := &models.Account{Email: a.Email, PasswordHash: a.PasswordHash}
+	if email != "" {
+		account.Email = email
+	}
+
+	var exists bool
+	err := imp.tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM accounts WHERE email = $1)`, account.Email).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check account: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrAccountExists, account.Email)
+	}
+
+	query := `INSERT INTO accounts (email, password_hash, created_at)
+	          VALUES ($1, $2, $3)
+	          RETURNING id, created_at, updated_at`
+	err = imp.tx.QueryRow(ctx, query, account.Email, account.PasswordHash, a.CreatedAt).
+		Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+	imp.account = account
+	return nil
+}
+
+func (imp *importer) device(ctx context.Context, d *archive.Device) error {
+	query := `INSERT INTO devices (account_id, name, device_type, public_key, last_seen_at, revoked_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          RETURNING id`
+
+	var id uuid.UUID
+	err := imp.tx.QueryRow(ctx, query,
+		imp.account.ID,
+		d.Name,
+		d.DeviceType,
+		d.PublicKey,
+		d.LastSeenAt,
+		d.RevokedAt,
+		d.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to import device: %w", err)
+	}
+	imp.devices[d.ID] = id
+	return nil
+}
+
+// chunk imports a chunk, checking it is stored under its own hash: chunks
+// are shared by every state of the account that lists the hash.
+func (imp *importer) chunk(ctx context.Context, c *archive.Chunk) error {
+	sum := sha256.Sum256(c.Data)
+	if hex.EncodeToString(sum[:]) != c.Hash {
+		return fmt.Errorf("%w: chunk %s does not match its hash", archive.ErrInvalidArchive, c.Hash)
+	}
+	if _, ok := imp.chunks[c.Hash]; ok {
+		return fmt.Errorf("%w: duplicate chunk %s", archive.ErrInvalidArchive, c.Hash)
+	}
+
+	query := `INSERT INTO chunks (account_id, hash, size, data, created_at)
+	          VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := imp.tx.Exec(ctx, query, imp.account.ID, c.Hash, len(c.Data), c.Data, c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to import chunk: %w", err)
+	}
+	imp.chunks[c.Hash] = int64(len(c.Data))
+	return nil
+}
+
+// state imports a state. Its size and content hash are recomputed rather
+// than trusted, as on any other write. States scoped only to devices that
+// weren't archived are skipped, since no imported device could read them.
+func (imp *importer) state(ctx context.Context, s *models.EncryptedState) error {
+	s.Size = int64(len(s.State) + len(s.Nonce))
+	for _, hash := range s.Chunks {
+		size, ok := imp.chunks[hash]
+		if !ok {
+			return fmt.Errorf("%w: state %s refers to missing chunk %s", archive.ErrInvalidArchive, s.Key, hash)
+		}
+		s.Size += size
+	}
+	s.ContentHash = contentHash(s)
+
+	visibleTo, ok := imp.deviceIDs(s.VisibleTo)
+	if !ok {
+		return nil
+	}
+
+	query := `INSERT INTO encrypted_states (account_id, device_id, key, state, nonce, chunks, version, size, content_hash,
+	                                        cipher_suite, key_id, key_generation, format_version,
+	                                        expires_at, created_at, updated_at, deleted_at, visible_to)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`
+
+	_, err := imp.tx.Exec(ctx, query,
+		imp.account.ID,
+		imp.deviceID(s.DeviceID),
+		s.Key,
+		s.State,
+		s.Nonce,
+		s.Chunks,
+		s.Version,
+		s.Size,
+		s.ContentHash,
+		s.CipherSuite,
+		s.KeyID,
+		s.KeyGeneration,
+		s.FormatVersion,
+		s.ExpiresAt,
+		s.CreatedAt,
+		s.UpdatedAt,
+		s.DeletedAt,
+		visibleTo,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to import state: %w", err)
+	}
+	return nil
+}
+
+// opLog imports the head of a key's op log, keeping its positions so the
+// log continues where it left off.
+func (imp *importer) opLog(ctx context.Context, l *archive.OpLog) error {
+	if _, ok := imp.opLogs[l.Key]; ok {
+		return fmt.Errorf("%w: duplicate op log %s", archive.ErrInvalidArchive, l.Key)
+	}
+	if l.SnapshotPosition < 0 || l.SnapshotPosition > l.Position {
+		return fmt.Errorf("%w: bad op log head %s", archive.ErrInvalidArchive, l.Key)
+	}
+
+	query := `INSERT INTO op_log_heads (account_id, key, position, snapshot_position, snapshot, snapshot_nonce,
+	                                    snapshot_device_id, snapshot_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	var snapshotDeviceID *uuid.UUID
+	if l.SnapshotDeviceID != nil {
+		snapshotDeviceID = imp.deviceID(*l.SnapshotDeviceID)
+	}
+	_, err := imp.tx.Exec(ctx, query,
+		imp.account.ID,
+		l.Key,
+		l.Position,
+		l.SnapshotPosition,
+		l.Snapshot,
+		l.SnapshotNonce,
+		snapshotDeviceID,
+		l.SnapshotAt,
+		l.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to import op log: %w", err)
+	}
+	imp.opLogs[l.Key] = l
+	return nil
+}
+
+// op imports an op at its archived position, which must lie between its
+// log's snapshot and head.
+func (imp *importer) op(ctx context.Context, op *models.StateOp) error {
+	l, ok := imp.opLogs[op.Key]
+	if !ok || op.Position <= l.SnapshotPosition || op.Position > l.Position {
+		return fmt.Errorf("%w: op %s/%d is outside its op log", archive.ErrInvalidArchive, op.Key, op.Position)
+	}
+
+	query := `INSERT INTO state_ops (account_id, key, position, device_id, op, nonce, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := imp.tx.Exec(ctx, query, imp.account.ID, op.Key, op.Position, imp.deviceID(op.DeviceID), op.Op, op.Nonce, op.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to import op: %w", err)
+	}
+	return nil
+}
+
+// event appends an archived event. Events get new sequence numbers, in
+// archive order, and the import time as their creation time: sync_events is
+// partitioned by creation time and the partitions for old events may have
+// been dropped. Like states, events no imported device could read are skipped.
+func (imp *importer) event(ctx context.Context, e *models.SyncEvent) error {
+	visibleTo, ok := imp.deviceIDs(e.VisibleTo)
+	if !ok {
+		return nil
+	}
+
+	query := `WITH ` + claimSequence + `
+	          INSERT INTO sync_events (account_id, device_id, event_type, state_key, state_version, payload, visible_to, sequence_number)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT last_sequence FROM seq))`
+
+	var stateKey *string
+	if e.StateKey != "" {
+		stateKey = &e.StateKey
+	}
+	var stateVersion *int64
+	if e.StateVersion != 0 {
+		stateVersion = &e.StateVersion
+	}
+
+	_, err := imp.tx.Exec(ctx, query,
+		imp.account.ID,
+		imp.deviceID(e.DeviceID),
+		e.EventType,
+		stateKey,
+		stateVersion,
+		e.Payload,
+		visibleTo,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to import event: %w", err)
+	}
+	return nil
+}
+
+func (imp *importer) retiredKey(ctx context.Context, k *models.RetiredKey) error {
+	query := `INSERT INTO retired_keys (account_id, key_id, retired_at) VALUES ($1, $2, $3)`
+
+	if _, err := imp.tx.Exec(ctx, query, imp.account.ID, k.KeyID, k.RetiredAt); err != nil {
+		return fmt.Errorf("failed to import retired key: %w", err)
+	}
+	return nil
+}
+
+// deviceID maps an archived device ID to the imported device, or NULL for
+// devices that were not exported (e.g. deleted ones).
+func (imp *importer) deviceID(archived uuid.UUID) *uuid.UUID {
+	id, ok := imp.devices[archived]
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// deviceIDs maps a device scope onto the imported devices. Devices that
+// weren't archived are dropped, so the scope never widens; nil stays nil.
+// It reports false if none of the scoped devices were archived: an empty
+// scope would read as "every device", so such records are skipped.
+func (imp *importer) deviceIDs(archived []uuid.UUID) ([]uuid.UUID, bool) {
+	if archived == nil {
+		return nil, true
+	}
+	var ids []uuid.UUID
+	for _, id := range archived {
+		if mapped := imp.deviceID(id); mapped != nil {
+			ids = append(ids, *mapped)
+		}
+	}
+	return ids, len(ids) > 0
+}
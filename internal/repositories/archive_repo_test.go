@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestArchiveRepository_ExportImport tests that an exported account comes back
+// under new IDs with its states, tombstones and events
+func TestArchiveRepository_ExportImport(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	stateRepo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	archiveRepo := NewPostgresArchiveRepository(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// ARRANGE: A live state, a tombstone and an event
+	for _, key := range []string{"keep", "gone"} {
+		state := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: key, State: []byte(key), Nonce: []byte("n")}
+		require.NoError(t, stateRepo.Upsert(ctx, state))
+		if key == "gone" {
+			require.NoError(t, stateRepo.Delete(ctx, state))
+		}
+	}
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		EventType: models.EventTypeUpdate,
+		StateKey:  "keep",
+	}))
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// ACT: Export, then import under a new email
+	var buf bytes.Buffer
+	w := archive.NewWriter(&buf, signingKey)
+	defer w.Close()
+	require.NoError(t, archiveRepo.Export(ctx, accountID, w, true))
+	require.NoError(t, w.Finish(accountID))
+
+	r, err := archive.NewReader(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	imported, err := archiveRepo.Import(ctx, r, "imported-"+uuid.New().String()+"@example.com")
+	require.NoError(t, err)
+	defer cleanupTestData(t, pool, ctx, imported.ID)
+
+	// ASSERT: Same content under new IDs
+	assert.NotEqual(t, accountID, imported.ID)
+
+	kept, err := stateRepo.GetByKey(ctx, imported.ID, "keep")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("keep"), kept.State)
+	assert.NotEqual(t, deviceID, kept.DeviceID, "Device IDs should be remapped")
+
+	tombstone, err := stateRepo.GetTombstone(ctx, imported.ID, "gone")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), tombstone.Version)
+
+	events, err := eventRepo.GetByAccountID(ctx, imported.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, kept.DeviceID, events[0].DeviceID)
+
+	usage, err := quotaRepo.GetUsage(ctx, imported.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), usage.KeyCount)
+}
+
+// TestArchiveRepository_ExportImportOpLogs tests that op logs come back with their snapshot, remaining ops and positions
+func TestArchiveRepository_ExportImportOpLogs(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	opLogRepo := NewPostgresOpLogRepository(pool, quotaRepo)
+	archiveRepo := NewPostgresArchiveRepository(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// ARRANGE: Three ops, the first two compacted into a snapshot
+	var ops []*models.StateOp
+	for _, op := range []string{"op1", "op2", "op3"} {
+		ops = append(ops, &models.StateOp{AccountID: accountID, DeviceID: deviceID, Key: "doc", Op: []byte(op), Nonce: []byte("n")})
+	}
+	require.NoError(t, opLogRepo.Append(ctx, ops))
+	require.NoError(t, opLogRepo.PublishSnapshot(ctx, &models.OpSnapshot{
+		AccountID: accountID, DeviceID: deviceID, Key: "doc", Position: 2, Snapshot: []byte("snap"), Nonce: []byte("n"),
+	}))
+	before, err := quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// ACT: Export, then import under a new email
+	var buf bytes.Buffer
+	w := archive.NewWriter(&buf, signingKey)
+	defer w.Close()
+	require.NoError(t, archiveRepo.Export(ctx, accountID, w, false))
+	require.NoError(t, w.Finish(accountID))
+
+	r, err := archive.NewReader(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	imported, err := archiveRepo.Import(ctx, r, "imported-"+uuid.New().String()+"@example.com")
+	require.NoError(t, err)
+	defer cleanupTestData(t, pool, ctx, imported.ID)
+
+	// ASSERT: The log continues where it left off, and is charged the same
+	head, err := opLogRepo.GetHead(ctx, imported.ID, "doc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), head.Position)
+	assert.Equal(t, int64(2), head.SnapshotPosition)
+
+	snapshot, err := opLogRepo.GetSnapshot(ctx, imported.ID, "doc")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("snap"), snapshot.Snapshot)
+
+	remaining, err := opLogRepo.ListAfter(ctx, imported.ID, "doc", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, int64(3), remaining[0].Position)
+	assert.Equal(t, []byte("op3"), remaining[0].Op)
+	assert.NotEqual(t, deviceID, remaining[0].DeviceID, "Device IDs should be remapped")
+
+	after, err := quotaRepo.GetUsage(ctx, imported.ID)
+	require.NoError(t, err)
+	assert.Equal(t, before.BytesUsed, after.BytesUsed)
+}
+
+// TestArchiveRepository_ImportRecomputesContent tests that imported states get their size and content hash from their content
+func TestArchiveRepository_ImportRecomputesContent(t *testing.T) {
+	pool := getTestPool(t)
+	stateRepo := newTestStateRepo(pool)
+	archiveRepo := NewPostgresArchiveRepository(pool)
+	ctx := context.Background()
+
+	// ARRANGE: A chunked state claiming a size and hash that don't match it
+	data := []byte("chunk")
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	forged := &models.EncryptedState{Key: "notes/big", State: []byte{}, Nonce: []byte("n"), Chunks: []string{hash}, Version: 1, Size: 1, ContentHash: "forged"}
+
+	// ACT
+	imported, err := importTestArchive(t, ctx, pool, archiveRepo, func(w *archive.Writer) {
+		require.NoError(t, w.Add(archive.FileChunks, archive.Chunk{Hash: hash, Data: data}))
+		require.NoError(t, w.Add(archive.FileStates, forged))
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+	state, err := stateRepo.GetByKey(ctx, imported.ID, "notes/big")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)+1), state.Size)
+	assert.Equal(t, contentHash(state), state.ContentHash)
+}
+
+// TestArchiveRepository_ImportRejectsInconsistentRecords tests that an import fails on records that contradict each other
+func TestArchiveRepository_ImportRejectsInconsistentRecords(t *testing.T) {
+	pool := getTestPool(t)
+	archiveRepo := NewPostgresArchiveRepository(pool)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		records func(w *archive.Writer) error
+	}{
+		{
+			name: "chunk under another hash",
+			records: func(w *archive.Writer) error {
+				return w.Add(archive.FileChunks, archive.Chunk{Hash: strings.Repeat("0", 64), Data: []byte("chunk")})
+			},
+		},
+		{
+			name: "op outside its op log",
+			records: func(w *archive.Writer) error {
+				if err := w.Add(archive.FileOpLogs, archive.OpLog{Key: "doc", Position: 2, SnapshotPosition: 1, Snapshot: []byte("snap"), SnapshotNonce: []byte("n")}); err != nil {
+					return err
+				}
+				return w.Add(archive.FileOps, &models.StateOp{Key: "doc", Position: 1, Op: []byte("op"), Nonce: []byte("n")})
+			},
+		},
+		{
+			name: "state referring to a missing chunk",
+			records: func(w *archive.Writer) error {
+				return w.Add(archive.FileStates, &models.EncryptedState{Key: "notes/big", State: []byte{}, Nonce: []byte("n"), Chunks: []string{strings.Repeat("0", 64)}, Version: 1})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := importTestArchive(t, ctx, pool, archiveRepo, func(w *archive.Writer) {
+				require.NoError(t, tt.records(w))
+			})
+			assert.ErrorIs(t, err, archive.ErrInvalidArchive)
+		})
+	}
+}
+
+// TestArchiveRepository_ImportSkipsUnreadableRecords tests that records scoped only to devices that weren't archived are left out
+func TestArchiveRepository_ImportSkipsUnreadableRecords(t *testing.T) {
+	pool := getTestPool(t)
+	stateRepo := newTestStateRepo(pool)
+	eventRepo := NewPostgresSyncEventRepository(pool, NewPostgresQuotaRepository(pool, models.QuotaLimits{}))
+	archiveRepo := NewPostgresArchiveRepository(pool)
+	ctx := context.Background()
+
+	// ARRANGE: One archived device, and records scoped to it or only to a device that wasn't archived
+	archived, deleted := uuid.New(), uuid.New()
+	scoped := func(key string, visibleTo ...uuid.UUID) *models.EncryptedState {
+		return &models.EncryptedState{DeviceID: archived, Key: key, State: []byte(key), Nonce: []byte("n"), Version: 1, VisibleTo: visibleTo}
+	}
+
+	// ACT
+	imported, err := importTestArchive(t, ctx, pool, archiveRepo, func(w *archive.Writer) {
+		require.NoError(t, w.Add(archive.FileDevices, archive.Device{ID: archived, Name: "Test Device"}))
+		require.NoError(t, w.Add(archive.FileStates, scoped("mixed", archived, deleted)))
+		require.NoError(t, w.Add(archive.FileStates, scoped("orphaned", deleted)))
+		for _, visibleTo := range [][]uuid.UUID{{archived}, {deleted}} {
+			require.NoError(t, w.Add(archive.FileEvents, &models.SyncEvent{DeviceID: archived, EventType: models.EventTypeUpdate, StateKey: "mixed", VisibleTo: visibleTo}))
+		}
+	})
+
+	// ASSERT: Only what an imported device can read came over, still scoped
+	require.NoError(t, err)
+	mixed, err := stateRepo.GetByKey(ctx, imported.ID, "mixed")
+	require.NoError(t, err)
+	require.Len(t, mixed.VisibleTo, 1)
+	assert.Equal(t, mixed.DeviceID, mixed.VisibleTo[0])
+
+	_, err = stateRepo.GetByKey(ctx, imported.ID, "orphaned")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	events, err := eventRepo.GetByAccountID(ctx, imported.ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+// Helper functions for test setup
+
+// importTestArchive imports a signed archive of a new account holding the
+// records added by add. The imported account is removed when the test ends.
+func importTestArchive(t *testing.T, ctx context.Context, pool *pgxpool.Pool, archiveRepo *PostgresArchiveRepository, add func(w *archive.Writer)) (*models.Account, error) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := archive.NewWriter(&buf, signingKey)
+	defer w.Close()
+	sourceID := uuid.New()
+	require.NoError(t, w.Add(archive.FileAccount, archive.Account{ID: sourceID, Email: "test-" + uuid.New().String() + "@example.com"}))
+	add(w)
+	require.NoError(t, w.Finish(sourceID))
+
+	r, err := archive.NewReader(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	imported, err := archiveRepo.Import(ctx, r, "")
+	if err == nil {
+		t.Cleanup(func() { cleanupTestData(t, pool, context.Background(), imported.ID) })
+	}
+	return imported, err
+}
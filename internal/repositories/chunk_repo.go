@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+type PostgresChunkRepository struct {
+	pool   *pgxpool.Pool
+	quotas *PostgresQuotaRepository
+}
+
+func NewPostgresChunkRepository(pool *pgxpool.Pool, quotas *PostgresQuotaRepository) *PostgresChunkRepository {
+	return &PostgresChunkRepository{pool: pool, quotas: quotas}
+}
+
+// Put stores a chunk. Chunks are content-addressed, so uploading a hash the
+// account already has is a no-op apart from refreshing touched_at.
+// Only newly stored chunks are charged against the account's storage quota.
+func (r *PostgresChunkRepository) Put(ctx context.Context, chunk *models.Chunk) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// xmax is 0 only for a freshly inserted row
+	query := `INSERT INTO chunks (account_id, hash, size, data)
+	          VALUES ($1, $2, $3, $4)
+	          ON CONFLICT (account_id, hash) DO UPDATE SET touched_at = NOW()
+	          RETURNING created_at, touched_at, xmax = 0`
+
+	var inserted bool
+	err = tx.QueryRow(ctx, query,
+		chunk.AccountID,
+		chunk.Hash,
+		len(chunk.Data),
+		chunk.Data,
+	).Scan(&chunk.CreatedAt, &chunk.TouchedAt, &inserted)
+
+	if err != nil {
+		return fmt.Errorf("failed to put chunk: %w", err)
+	}
+	chunk.Size = len(chunk.Data)
+
+	if inserted {
+		if err := r.quotas.charge(ctx, tx, chunk.AccountID, usageDelta{Bytes: int64(chunk.Size)}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit chunk: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresChunkRepository) Get(ctx context.Context, accountID uuid.UUID, hash string) (*models.Chunk, error) {
+	query := `SELECT account_id, hash, size, data, created_at, touched_at
+	          FROM chunks
+	          WHERE account_id = $1 AND hash = $2`
+
+	var chunk models.Chunk
+	err := r.pool.QueryRow(ctx, query, accountID, hash).Scan(
+		&chunk.AccountID,
+		&chunk.Hash,
+		&chunk.Size,
+		&chunk.Data,
+		&chunk.CreatedAt,
+		&chunk.TouchedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk: %w", err)
+	}
+	return &chunk, nil
+}
+
+// Missing returns the hashes from the list that the account has not uploaded
+// yet, preserving their order. Chunks that are present get their touched_at
+// refreshed so garbage collection leaves them alone while the client finishes
+// an interrupted upload.
+func (r *PostgresChunkRepository) Missing(ctx context.Context, accountID uuid.UUID, hashes []string) ([]string, error) {
+	query := `UPDATE chunks
+	          SET touched_at = NOW()
+	          WHERE account_id = $1 AND hash = ANY($2)
+	          RETURNING hash`
+
+	rows, err := r.pool.Query(ctx, query, accountID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk hash: %w", err)
+		}
+		present[hash] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chunks: %w", err)
+	}
+
+	missing := []string{}
+	seen := make(map[string]bool)
+	for _, hash := range hashes {
+		if present[hash] || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		missing = append(missing, hash)
+	}
+	return missing, nil
+}
+
+// DeleteUnreferenced removes chunks that no encrypted state references and
+// that have not been uploaded or checked since the cutoff, releasing their
+// bytes from each account's usage.
+func (r *PostgresChunkRepository) DeleteUnreferenced(ctx context.Context, touchedBefore time.Time) (int64, error) {
+	query := `WITH deleted AS (
+	              DELETE FROM chunks c
+	              WHERE c.touched_at < $1
+	                AND NOT EXISTS (
+	                    SELECT 1 FROM encrypted_states s
+	                    WHERE s.account_id = c.account_id AND s.chunks @> ARRAY[c.hash]
+	                )
+	              RETURNING c.account_id, c.size
+	          ), released AS (
+	              UPDATE account_usage u
+	              SET bytes_used = u.bytes_used - d.total, updated_at = NOW()
+	              FROM (SELECT account_id, SUM(size) AS total FROM deleted GROUP BY account_id) d
+	              WHERE u.account_id = d.account_id
+	          )
+	          SELECT COUNT(*) FROM deleted`
+
+	var deleted int64
+	err := r.pool.QueryRow(ctx, query, touchedBefore).Scan(&deleted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unreferenced chunks: %w", err)
+	}
+	return deleted, nil
+}
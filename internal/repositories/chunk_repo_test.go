@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChunkRepository_PutIsIdempotent tests that re-uploading a chunk is a no-op
+func TestChunkRepository_PutIsIdempotent(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresChunkRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, _ := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	chunk := &models.Chunk{AccountID: accountID, Hash: "hash-a", Data: []byte("chunk-a")}
+	require.NoError(t, repo.Put(ctx, chunk))
+
+	// ACT: Upload the same chunk again
+	again := &models.Chunk{AccountID: accountID, Hash: "hash-a", Data: []byte("chunk-a")}
+	err := repo.Put(ctx, again)
+
+	// ASSERT: Should succeed and keep the original row
+	require.NoError(t, err)
+	assert.Equal(t, chunk.CreatedAt, again.CreatedAt, "Original chunk should be kept")
+
+	retrieved, err := repo.Get(ctx, accountID, "hash-a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk-a"), retrieved.Data)
+	assert.Equal(t, 7, retrieved.Size)
+}
+
+// TestChunkRepository_Missing tests that only chunks not yet uploaded are reported
+func TestChunkRepository_Missing(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresChunkRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, _ := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	require.NoError(t, repo.Put(ctx, &models.Chunk{AccountID: accountID, Hash: "hash-b", Data: []byte("b")}))
+
+	// ACT: Ask which of three chunks are missing (one listed twice)
+	missing, err := repo.Missing(ctx, accountID, []string{"hash-c", "hash-b", "hash-d", "hash-c"})
+
+	// ASSERT: Uploaded chunk is excluded, order is preserved, duplicates collapse
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hash-c", "hash-d"}, missing)
+}
+
+// TestChunkRepository_DeleteUnreferenced tests garbage collection keeps referenced chunks
+func TestChunkRepository_DeleteUnreferenced(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresChunkRepository(pool, quotaRepo)
+	stateRepo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	require.NoError(t, repo.Put(ctx, &models.Chunk{AccountID: accountID, Hash: "hash-used", Data: []byte("used")}))
+	require.NoError(t, repo.Put(ctx, &models.Chunk{AccountID: accountID, Hash: "hash-orphan", Data: []byte("orphan")}))
+
+	state := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Key:       "large-blob",
+		State:     []byte{},
+		Nonce:     []byte("nonce"),
+		Chunks:    []string{"hash-used"},
+	}
+	require.NoError(t, stateRepo.Upsert(ctx, state))
+
+	// ACT: Collect everything touched before now
+	_, err := repo.DeleteUnreferenced(ctx, time.Now().Add(time.Minute))
+
+	// ASSERT: Referenced chunk survives, orphan is gone
+	require.NoError(t, err)
+	_, err = repo.Get(ctx, accountID, "hash-used")
+	assert.NoError(t, err, "Referenced chunk should be kept")
+	_, err = repo.Get(ctx, accountID, "hash-orphan")
+	assert.ErrorIs(t, err, ErrNotFound, "Unreferenced chunk should be deleted")
+}
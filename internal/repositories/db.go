@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DBTX is the query API shared by *pgxpool.Pool and pgx.Tx, so query helpers
+// can run either on the pool or inside a transaction.
+type DBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Transactor begins transactions that several repositories' Tx methods can
+// share, so a service can commit their writes together.
+type Transactor interface {
+	Begin(ctx context.Context) (*Tx, error)
+}
+
+// Tx is a transaction begun by a Transactor. Repositories queue work that
+// has to wait for the outcome, such as removing blobs from the blob store,
+// with OnCommit and OnRollback.
+type Tx struct {
+	pgx.Tx
+	onCommit   []func()
+	onRollback []func()
+	done       bool
+}
+
+// OnCommit queues f to run once the transaction commits.
+func (tx *Tx) OnCommit(f func()) {
+	tx.onCommit = append(tx.onCommit, f)
+}
+
+// OnRollback queues f to run if the transaction rolls back or fails to commit.
+func (tx *Tx) OnRollback(f func()) {
+	tx.onRollback = append(tx.onRollback, f)
+}
+
+// Commit commits the transaction and runs the work queued for its outcome.
+func (tx *Tx) Commit(ctx context.Context) error {
+	err := tx.Tx.Commit(ctx)
+	tx.finish(err == nil)
+	return err
+}
+
+// Rollback rolls the transaction back unless it has already ended, so it
+// can be deferred right after Begin.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	err := tx.Tx.Rollback(ctx)
+	tx.finish(false)
+	return err
+}
+
+func (tx *Tx) finish(committed bool) {
+	if tx.done {
+		return
+	}
+	tx.done = true
+
+	hooks := tx.onRollback
+	if committed {
+		hooks = tx.onCommit
+	}
+	for _, f := range hooks {
+		f()
+	}
+}
+
+type PostgresTransactor struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresTransactor(pool *pgxpool.Pool) *PostgresTransactor {
+	return &PostgresTransactor{pool: pool}
+}
+
+func (t *PostgresTransactor) Begin(ctx context.Context) (*Tx, error) {
+	return beginTx(ctx, t.pool)
+}
+
+// beginTx begins a Tx on pool.
+func beginTx(ctx context.Context, pool *pgxpool.Pool) (*Tx, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+// inTx runs fn in a transaction of its own and commits it if fn succeeds.
+func inTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx *Tx) error) error {
+	tx, err := beginTx(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/prudhvinik1/edgesync/internal/models"
 )
 
+// ErrSequenceAhead is returned when a device acknowledges events that don't exist yet
+var ErrSequenceAhead = errors.New("sequence number is past the end of the event stream")
+
 type PostgresDeviceRepository struct {
 	pool *pgxpool.Pool
 }
@@ -40,7 +43,8 @@ func (r *PostgresDeviceRepository) Create(ctx context.Context, device *models.De
 
 func (r *PostgresDeviceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Device, error) {
 	query := `SELECT id, account_id, name, device_type, public_key, 
-	                 last_seen_at, revoked_at, created_at, updated_at, deleted_at 
+	                 last_seen_at, revoked_at, created_at, updated_at, deleted_at,
+	                 synced_sequence, synced_at
 	          FROM devices 
 	          WHERE id = $1 AND deleted_at IS NULL`
 
@@ -56,6 +60,8 @@ func (r *PostgresDeviceRepository) GetByID(ctx context.Context, id uuid.UUID) (*
 		&device.CreatedAt,
 		&device.UpdatedAt,
 		&device.DeletedAt,
+		&device.SyncedSequence,
+		&device.SyncedAt,
 	)
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -69,7 +75,8 @@ func (r *PostgresDeviceRepository) GetByID(ctx context.Context, id uuid.UUID) (*
 
 func (r *PostgresDeviceRepository) GetDevicesByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.Device, error) {
 	query := `SELECT id, account_id, name, device_type, public_key, 
-	                 last_seen_at, revoked_at, created_at, updated_at, deleted_at 
+	                 last_seen_at, revoked_at, created_at, updated_at, deleted_at,
+	                 synced_sequence, synced_at
 	          FROM devices 
 	          WHERE account_id = $1 AND deleted_at IS NULL
 	          ORDER BY created_at DESC`
@@ -94,6 +101,8 @@ func (r *PostgresDeviceRepository) GetDevicesByAccountID(ctx context.Context, ac
 			&device.CreatedAt,
 			&device.UpdatedAt,
 			&device.DeletedAt,
+			&device.SyncedSequence,
+			&device.SyncedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device: %w", err)
@@ -144,3 +153,86 @@ func (r *PostgresDeviceRepository) Revoke(ctx context.Context, id uuid.UUID) err
 	}
 	return nil
 }
+
+// AckSequence records that an active device of the account has applied the
+// events up to sequenceNumber. Acknowledging less than the device's current
+// cursor leaves it unchanged; acknowledging past the account's last event
+// fails with ErrSequenceAhead.
+func (r *PostgresDeviceRepository) AckSequence(ctx context.Context, accountID, deviceID uuid.UUID, sequenceNumber int64) error {
+	var last int64
+	query := `SELECT COALESCE((SELECT last_sequence FROM sync_sequences WHERE account_id = $1), 0)`
+	if err := r.pool.QueryRow(ctx, query, accountID).Scan(&last); err != nil {
+		return fmt.Errorf("failed to get last sequence: %w", err)
+	}
+	if sequenceNumber > last {
+		return fmt.Errorf("%w: last event is %d", ErrSequenceAhead, last)
+	}
+
+	query = `UPDATE devices
+	         SET synced_sequence = GREATEST(synced_sequence, $3), synced_at = NOW()
+	         WHERE id = $2 AND account_id = $1 AND revoked_at IS NULL AND deleted_at IS NULL`
+
+	result, err := r.pool.Exec(ctx, query, accountID, deviceID, sequenceNumber)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge sequence: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetSyncStatusByAccountID returns the account's devices with their lag.
+// Events scoped to other devices don't count towards a device's lag.
+func (r *PostgresDeviceRepository) GetSyncStatusByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.DeviceStatus, error) {
+	query := `SELECT d.id, d.account_id, d.name, d.device_type, d.public_key,
+	                 d.last_seen_at, d.revoked_at, d.created_at, d.updated_at, d.deleted_at,
+	                 d.synced_sequence, d.synced_at,
+	                 lag.events, COALESCE(EXTRACT(EPOCH FROM NOW() - lag.oldest)::BIGINT, 0)
+	          FROM devices d
+	          CROSS JOIN LATERAL (
+	              SELECT COUNT(*) AS events, MIN(e.created_at) AS oldest
+	              FROM sync_events e
+	              WHERE e.account_id = d.account_id AND e.sequence_number > d.synced_sequence
+	                AND (e.visible_to IS NULL OR d.id = ANY(e.visible_to))
+	          ) lag
+	          WHERE d.account_id = $1 AND d.deleted_at IS NULL
+	          ORDER BY d.created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device sync status: %w", err)
+	}
+	defer rows.Close()
+
+	var statuses []*models.DeviceStatus
+	for rows.Next() {
+		status := models.DeviceStatus{Device: &models.Device{}}
+		err := rows.Scan(
+			&status.ID,
+			&status.AccountID,
+			&status.Name,
+			&status.DeviceType,
+			&status.PublicKey,
+			&status.LastSeenAt,
+			&status.RevokedAt,
+			&status.CreatedAt,
+			&status.UpdatedAt,
+			&status.DeletedAt,
+			&status.SyncedSequence,
+			&status.SyncedAt,
+			&status.EventsBehind,
+			&status.SecondsBehind,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device sync status: %w", err)
+		}
+		statuses = append(statuses, &status)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device sync status: %w", err)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeviceRepository_SyncCursorsAndLag tests that acknowledged cursors drive the reported lag
+func TestDeviceRepository_SyncCursorsAndLag(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, laptopID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	phone := &models.Device{AccountID: accountID, Name: "Phone", DeviceType: "mobile"}
+	require.NoError(t, deviceRepo.Create(ctx, phone))
+
+	// ARRANGE: Three events, the last one only for the laptop
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: laptopID, EventType: models.EventTypeUpdate, StateKey: "a"}))
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: laptopID, EventType: models.EventTypeUpdate, StateKey: "b"}))
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: laptopID, EventType: models.EventTypeUpdate, StateKey: "c", VisibleTo: []uuid.UUID{laptopID}}))
+
+	// ACT: The laptop acknowledges the first event; a stale ack doesn't move it back
+	require.NoError(t, deviceRepo.AckSequence(ctx, accountID, laptopID, 1))
+	require.NoError(t, deviceRepo.AckSequence(ctx, accountID, laptopID, 0))
+	aheadErr := deviceRepo.AckSequence(ctx, accountID, laptopID, 4)
+	foreignErr := deviceRepo.AckSequence(ctx, uuid.New(), laptopID, 0)
+
+	// ASSERT: Lag counts only the events each device may receive
+	assert.ErrorIs(t, aheadErr, ErrSequenceAhead)
+	assert.ErrorIs(t, foreignErr, ErrNotFound)
+
+	statuses, err := deviceRepo.GetSyncStatusByAccountID(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+
+	byID := map[uuid.UUID]*models.DeviceStatus{}
+	for _, status := range statuses {
+		byID[status.ID] = status
+	}
+	laptop, phoneStatus := byID[laptopID], byID[phone.ID]
+
+	assert.Equal(t, int64(1), laptop.SyncedSequence)
+	assert.NotNil(t, laptop.SyncedAt)
+	assert.Equal(t, int64(2), laptop.EventsBehind)
+
+	assert.Equal(t, int64(0), phoneStatus.SyncedSequence)
+	assert.Nil(t, phoneStatus.SyncedAt)
+	assert.Equal(t, int64(2), phoneStatus.EventsBehind, "Events scoped to the laptop don't count for the phone")
+
+	// Catching up clears the lag
+	require.NoError(t, deviceRepo.AckSequence(ctx, accountID, laptopID, 3))
+	statuses, err = deviceRepo.GetSyncStatusByAccountID(ctx, accountID)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		if status.ID == laptopID {
+			assert.Equal(t, int64(0), status.EventsBehind)
+			assert.Equal(t, int64(0), status.SecondsBehind)
+		}
+	}
+}
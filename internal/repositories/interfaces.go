@@ -2,8 +2,10 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/archive"
 	"github.com/prudhvinik1/edgesync/internal/models"
 )
 
@@ -21,29 +23,104 @@ type DeviceRepository interface {
 	GetDevicesByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.Device, error)
 	Update(ctx context.Context, device *models.Device) error
 	Revoke(ctx context.Context, id uuid.UUID) error
+	AckSequence(ctx context.Context, accountID, deviceID uuid.UUID, sequenceNumber int64) error
+	GetSyncStatusByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.DeviceStatus, error)
 }
 
 type EncryptedStateRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.EncryptedState, error)
 	GetByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.EncryptedState, error)
 	GetByKey(ctx context.Context, accountID uuid.UUID, key string) (*models.EncryptedState, error)
+	GetByKeyAs(ctx context.Context, actorID, ownerID uuid.UUID, key string) (*models.EncryptedState, error)
+	ListByPrefix(ctx context.Context, accountID, deviceID uuid.UUID, prefix, after string, limit int) ([]*models.EncryptedState, error)
+	GetManifest(ctx context.Context, accountID, deviceID uuid.UUID, prefix string) ([]*models.StateManifestEntry, error)
+	ListByKeyID(ctx context.Context, accountID, deviceID uuid.UUID, keyID string) ([]*models.StateManifestEntry, error)
 	Upsert(ctx context.Context, state *models.EncryptedState) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	UpsertAs(ctx context.Context, actorID uuid.UUID, state *models.EncryptedState) error
+	UpsertTx(ctx context.Context, tx *Tx, actorID uuid.UUID, state *models.EncryptedState) (string, error)
+	Delete(ctx context.Context, state *models.EncryptedState) error
+	DeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error
+	GetTombstone(ctx context.Context, accountID uuid.UUID, key string) (*models.EncryptedState, error)
+	Undelete(ctx context.Context, state *models.EncryptedState) error
+	UndeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error
+	PurgeTombstones(ctx context.Context, deletedBefore time.Time) (int64, error)
+	ExpiredAccountIDs(ctx context.Context, limit int) ([]uuid.UUID, error)
+	ReapExpired(ctx context.Context, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error)
+	ReapExpiredTx(ctx context.Context, tx *Tx, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error)
+}
+
+type OpLogRepository interface {
+	Append(ctx context.Context, ops []*models.StateOp) error
+	ListAfter(ctx context.Context, accountID uuid.UUID, key string, after int64, limit int) ([]*models.StateOp, error)
+	GetHead(ctx context.Context, accountID uuid.UUID, key string) (*models.OpLogHead, error)
+	GetSnapshot(ctx context.Context, accountID uuid.UUID, key string) (*models.OpSnapshot, error)
+	PublishSnapshot(ctx context.Context, snapshot *models.OpSnapshot) error
+}
+
+type LeaseRepository interface {
+	Acquire(ctx context.Context, lease *models.Lease, ttl time.Duration) error
+	Renew(ctx context.Context, accountID uuid.UUID, key string, deviceID uuid.UUID, ttl time.Duration) (*models.Lease, error)
+	Release(ctx context.Context, accountID uuid.UUID, key string, deviceID uuid.UUID) error
+	Get(ctx context.Context, accountID uuid.UUID, key string) (*models.Lease, error)
+}
+
+type ChunkRepository interface {
+	Put(ctx context.Context, chunk *models.Chunk) error
+	Get(ctx context.Context, accountID uuid.UUID, hash string) (*models.Chunk, error)
+	Missing(ctx context.Context, accountID uuid.UUID, hashes []string) ([]string, error)
+	DeleteUnreferenced(ctx context.Context, touchedBefore time.Time) (int64, error)
+}
+
+type EncryptionKeyRepository interface {
+	Retire(ctx context.Context, accountID uuid.UUID, keyID string) (*models.RetiredKey, error)
+	ListRetired(ctx context.Context, accountID uuid.UUID) ([]*models.RetiredKey, error)
+}
+
+type ShareRepository interface {
+	Grant(ctx context.Context, share *models.StateShare) error
+	Revoke(ctx context.Context, ownerID, stateID, granteeID uuid.UUID) error
+	Get(ctx context.Context, stateID, granteeID uuid.UUID) (*models.StateShare, error)
+	ListByState(ctx context.Context, stateID uuid.UUID) ([]*models.StateShare, error)
+	ListByGrantee(ctx context.Context, granteeID uuid.UUID) ([]*models.StateShare, error)
+	HasChunkAccess(ctx context.Context, ownerID, granteeID uuid.UUID, hash string) (bool, error)
+}
+
+type ArchiveRepository interface {
+	Export(ctx context.Context, accountID uuid.UUID, w *archive.Writer, includeCredentials bool) error
+	Import(ctx context.Context, r *archive.Reader, email string) (*models.Account, error)
+}
+
+type QuotaRepository interface {
+	GetLimits(ctx context.Context, accountID uuid.UUID) (*models.QuotaLimits, error)
+	SetLimits(ctx context.Context, accountID uuid.UUID, limits *models.QuotaLimits) error
+	GetUsage(ctx context.Context, accountID uuid.UUID) (*models.AccountUsage, error)
 }
 
 type SessionRepository interface {
 	Create(ctx context.Context, session *models.Session) error
 	GetByID(ctx context.Context, id string) (*models.Session, error)
-	GetByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.Session, error)
+	ListByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.Session, error)
 	Delete(ctx context.Context, id string) error
 	DeleteAllForAccount(ctx context.Context, accountID uuid.UUID) error
 }
 
 type SyncEventRepository interface {
 	Append(ctx context.Context, event *models.SyncEvent) error
+	AppendTx(ctx context.Context, tx *Tx, event *models.SyncEvent) error
+	AppendStateEventTx(ctx context.Context, tx *Tx, stateID uuid.UUID, event *models.SyncEvent) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.SyncEvent, error)
 	GetByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.SyncEvent, error)
-	GetSinceSequence(ctx context.Context, accountID uuid.UUID, sequenceNumber int64) ([]*models.SyncEvent, error)
+	GetSinceSequence(ctx context.Context, accountID, deviceID uuid.UUID, sequenceNumber int64, filter models.EventFilter, limit int) ([]*models.SyncEvent, error)
+	GetHorizon(ctx context.Context, accountID uuid.UUID) (int64, error)
+	Compact(ctx context.Context, cutoff time.Time, limit int) (accounts, dropped int64, err error)
+	EnsurePartitions(ctx context.Context, now time.Time, months int) (int, error)
+	DropPartitionsBefore(ctx context.Context, cutoff time.Time) (int, error)
+	Listen(ctx context.Context, notify func(accountID uuid.UUID)) error
+}
+
+type WaiterRepository interface {
+	Acquire(ctx context.Context, accountID, waiterID uuid.UUID, limit int, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, accountID, waiterID uuid.UUID) error
 }
 
 type PresenceRepository interface {
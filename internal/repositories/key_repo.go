@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// PostgresEncryptionKeyRepository tracks the client key IDs an account has
+// retired. The server never holds keys; it only refuses new writes under a
+// retired key ID (see PostgresEncryptedStateRepository.Upsert).
+type PostgresEncryptionKeyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresEncryptionKeyRepository(pool *pgxpool.Pool) *PostgresEncryptionKeyRepository {
+	return &PostgresEncryptionKeyRepository{pool: pool}
+}
+
+// Retire marks a key ID as retired. Retiring an already retired key is a
+// no-op that returns the original retirement.
+func (r *PostgresEncryptionKeyRepository) Retire(ctx context.Context, accountID uuid.UUID, keyID string) (*models.RetiredKey, error) {
+	// The no-op update makes RETURNING yield the existing row on conflict
+	query := `INSERT INTO retired_keys (account_id, key_id)
+	          VALUES ($1, $2)
+	          ON CONFLICT (account_id, key_id) DO UPDATE SET key_id = EXCLUDED.key_id
+	          RETURNING retired_at`
+
+	key := models.RetiredKey{AccountID: accountID, KeyID: keyID}
+	if err := r.pool.QueryRow(ctx, query, accountID, keyID).Scan(&key.RetiredAt); err != nil {
+		return nil, fmt.Errorf("failed to retire key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListRetired returns an account's retired key IDs, oldest first.
+func (r *PostgresEncryptionKeyRepository) ListRetired(ctx context.Context, accountID uuid.UUID) ([]*models.RetiredKey, error) {
+	query := `SELECT account_id, key_id, retired_at
+	          FROM retired_keys
+	          WHERE account_id = $1
+	          ORDER BY retired_at ASC, key_id ASC`
+
+	rows, err := r.pool.Query(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retired keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.RetiredKey{}
+	for rows.Next() {
+		var key models.RetiredKey
+		if err := rows.Scan(&key.AccountID, &key.KeyID, &key.RetiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan retired key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retired keys: %w", err)
+	}
+
+	return keys, nil
+}
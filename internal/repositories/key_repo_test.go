@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncryptionKeyRepository_RetireRejectsWrites tests that states under an old key
+// can be found, and that a retired key cannot be written under
+func TestEncryptionKeyRepository_RetireRejectsWrites(t *testing.T) {
+	pool := getTestPool(t)
+	stateRepo := newTestStateRepo(pool)
+	keyRepo := NewPostgresEncryptionKeyRepository(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// ARRANGE: One state under the old key, one under the new key
+	for key, keyID := range map[string]string{"a": "k1", "b": "k2"} {
+		state := &models.EncryptedState{
+			AccountID: accountID,
+			DeviceID:  deviceID,
+			Key:       key,
+			State:     []byte("data-" + key),
+			Nonce:     []byte("nonce"),
+			EncryptionEnvelope: models.EncryptionEnvelope{
+				CipherSuite:   "xchacha20poly1305",
+				KeyID:         keyID,
+				KeyGeneration: 1,
+				FormatVersion: 1,
+			},
+		}
+		require.NoError(t, stateRepo.Upsert(ctx, state))
+	}
+
+	// ACT: List states under the old key, then retire it
+	entries, err := stateRepo.ListByKeyID(ctx, accountID, deviceID, "k1")
+	require.NoError(t, err)
+
+	retired, err := keyRepo.Retire(ctx, accountID, "k1")
+	require.NoError(t, err)
+	again, err := keyRepo.Retire(ctx, accountID, "k1")
+	require.NoError(t, err)
+
+	rewrite := &models.EncryptedState{
+		AccountID:          accountID,
+		DeviceID:           deviceID,
+		Key:                "a",
+		State:              []byte("still-k1"),
+		Nonce:              []byte("nonce"),
+		Version:            1,
+		EncryptionEnvelope: models.EncryptionEnvelope{KeyID: "k1"},
+	}
+	writeErr := stateRepo.Upsert(ctx, rewrite)
+
+	// ASSERT: Only the old-key state is listed, and writes under it are rejected
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a", entries[0].Key)
+	assert.Equal(t, "xchacha20poly1305", entries[0].CipherSuite)
+	assert.Equal(t, retired.RetiredAt, again.RetiredAt, "Retiring twice should keep the original retirement")
+	assert.ErrorIs(t, writeErr, ErrKeyRetired)
+
+	keys, err := keyRepo.ListRetired(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "k1", keys[0].KeyID)
+
+	// Re-encrypting under the new key still works
+	rewrite.KeyID = "k2"
+	require.NoError(t, stateRepo.Upsert(ctx, rewrite))
+}
@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLeaseHeld is returned when another device holds the lease on a key
+var ErrLeaseHeld = errors.New("state is leased by another device")
+
+// ErrLeaseNotHeld is returned when renewing or releasing a lease the device doesn't hold
+var ErrLeaseNotHeld = errors.New("lease is not held by this device")
+
+const leasePrefix = "lease:"
+
+// leaseScript changes the lease at KEYS[1] on behalf of device ARGV[2],
+// failing if another device holds it. ARGV[1] is the operation:
+//   - acquire stores payload ARGV[4] with TTL ARGV[3] ms
+//   - renew resets the TTL to ARGV[3] ms; the lease must exist
+//   - release deletes the lease; the lease must exist
+//
+// It returns {ok, current payload, TTL in ms}; on failure the payload is the
+// other device's lease, or an empty string if there is none.
+var leaseScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current and cjson.decode(current).device_id ~= ARGV[2] then
+	return {0, current, redis.call('PTTL', KEYS[1])}
+end
+if ARGV[1] == 'acquire' then
+	redis.call('SET', KEYS[1], ARGV[4], 'PX', ARGV[3])
+	return {1, ARGV[4], tonumber(ARGV[3])}
+end
+if not current then
+	return {0, '', 0}
+end
+if ARGV[1] == 'renew' then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return {1, current, tonumber(ARGV[3])}
+end
+redis.call('DEL', KEYS[1])
+return {1, current, 0}
+`)
+
+// leaseRecord is what Redis stores for a lease. The expiry is the key's TTL.
+type leaseRecord struct {
+	DeviceID   string    `json:"device_id"`
+	Enforced   bool      `json:"enforced"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// RedisLeaseRepository keeps edit leases in Redis, where they expire on
+// their own if the holder disappears.
+type RedisLeaseRepository struct {
+	client *redis.Client
+}
+
+func NewRedisLeaseRepository(client *redis.Client) *RedisLeaseRepository {
+	return &RedisLeaseRepository{client: client}
+}
+
+// Acquire takes the lease described by lease for ttl. A device acquiring a
+// lease it already holds replaces it. If another device holds the lease,
+// ErrLeaseHeld is returned naming the holder. On success AcquiredAt and
+// ExpiresAt are set.
+func (r *RedisLeaseRepository) Acquire(ctx context.Context, lease *models.Lease, ttl time.Duration) error {
+	payload, err := json.Marshal(leaseRecord{
+		DeviceID:   lease.DeviceID.String(),
+		Enforced:   lease.Enforced,
+		AcquiredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal lease: %w", err)
+	}
+
+	current, err := r.run(ctx, "acquire", lease.AccountID, lease.Key, lease.DeviceID, ttl, string(payload))
+	if err != nil {
+		return err
+	}
+	*lease = *current
+	return nil
+}
+
+// Renew extends a lease the device holds to expire ttl from now.
+func (r *RedisLeaseRepository) Renew(ctx context.Context, accountID uuid.UUID, key string, deviceID uuid.UUID, ttl time.Duration) (*models.Lease, error) {
+	return r.run(ctx, "renew", accountID, key, deviceID, ttl, "")
+}
+
+// Release gives up a lease the device holds.
+func (r *RedisLeaseRepository) Release(ctx context.Context, accountID uuid.UUID, key string, deviceID uuid.UUID) error {
+	_, err := r.run(ctx, "release", accountID, key, deviceID, 0, "")
+	return err
+}
+
+// Get returns the active lease on a key, or ErrNotFound.
+func (r *RedisLeaseRepository) Get(ctx context.Context, accountID uuid.UUID, key string) (*models.Lease, error) {
+	redisKey := leaseKey(accountID, key)
+
+	pipe := r.client.Pipeline()
+	get := pipe.Get(ctx, redisKey)
+	pttl := pipe.PTTL(ctx, redisKey)
+	_, err := pipe.Exec(ctx)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease: %w", err)
+	}
+
+	return decodeLease(accountID, key, get.Val(), pttl.Val())
+}
+
+func (r *RedisLeaseRepository) run(ctx context.Context, op string, accountID uuid.UUID, key string, deviceID uuid.UUID, ttl time.Duration, payload string) (*models.Lease, error) {
+	result, err := leaseScript.Run(ctx, r.client, []string{leaseKey(accountID, key)},
+		op, deviceID.String(), ttl.Milliseconds(), payload).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s lease: %w", op, err)
+	}
+	if len(result) != 3 {
+		return nil, fmt.Errorf("failed to %s lease: unexpected reply %v", op, result)
+	}
+
+	ok, _ := result[0].(int64)
+	current, _ := result[1].(string)
+	remaining, _ := result[2].(int64)
+
+	if ok == 1 {
+		return decodeLease(accountID, key, current, time.Duration(remaining)*time.Millisecond)
+	}
+	if current == "" {
+		return nil, ErrLeaseNotHeld
+	}
+	holder, err := decodeLease(accountID, key, current, time.Duration(remaining)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return nil, leaseHeldError(holder)
+}
+
+func decodeLease(accountID uuid.UUID, key, payload string, ttl time.Duration) (*models.Lease, error) {
+	var record leaseRecord
+	if err := json.Unmarshal([]byte(payload), &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+	}
+	deviceID, err := uuid.Parse(record.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lease: %w", err)
+	}
+
+	return &models.Lease{
+		AccountID:  accountID,
+		Key:        key,
+		DeviceID:   deviceID,
+		Enforced:   record.Enforced,
+		AcquiredAt: record.AcquiredAt,
+		ExpiresAt:  time.Now().Add(ttl).UTC(),
+	}, nil
+}
+
+// leaseHeldError wraps ErrLeaseHeld with who holds the lease and until when,
+// so clients can tell the user.
+func leaseHeldError(lease *models.Lease) error {
+	return fmt.Errorf("%w: held by device %s until %s", ErrLeaseHeld, lease.DeviceID, lease.ExpiresAt.Format(time.RFC3339))
+}
+
+func leaseKey(accountID uuid.UUID, key string) string {
+	return fmt.Sprintf("%s%s:%s", leasePrefix, accountID, key)
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLeaseRepository_ExclusiveAcquire tests that only one device holds a lease at a time
+func TestLeaseRepository_ExclusiveAcquire(t *testing.T) {
+	client := getTestRedisClient(t)
+	repo := NewRedisLeaseRepository(client)
+	ctx := context.Background()
+
+	defer cleanupTestLeases(t, client, ctx)
+
+	accountID := uuid.New()
+	laptop := uuid.New()
+	phone := uuid.New()
+
+	lease := &models.Lease{AccountID: accountID, Key: "notes/todo", DeviceID: laptop}
+	require.NoError(t, repo.Acquire(ctx, lease, 30*time.Second))
+
+	// ACT: Another device tries to take the same lease
+	err := repo.Acquire(ctx, &models.Lease{AccountID: accountID, Key: "notes/todo", DeviceID: phone}, 30*time.Second)
+
+	// ASSERT: Rejected, and the holder is unchanged
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+	assert.Contains(t, err.Error(), laptop.String(), "Error should name the holder")
+
+	holder, err := repo.Get(ctx, accountID, "notes/todo")
+	require.NoError(t, err)
+	assert.Equal(t, laptop, holder.DeviceID)
+
+	// Only the holder can renew or release
+	_, err = repo.Renew(ctx, accountID, "notes/todo", phone, time.Minute)
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+
+	renewed, err := repo.Renew(ctx, accountID, "notes/todo", laptop, time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), renewed.ExpiresAt, 2*time.Second)
+
+	require.NoError(t, repo.Release(ctx, accountID, "notes/todo", laptop))
+	assert.ErrorIs(t, repo.Release(ctx, accountID, "notes/todo", laptop), ErrLeaseNotHeld)
+
+	// Once released, the other device can take it
+	require.NoError(t, repo.Acquire(ctx, &models.Lease{AccountID: accountID, Key: "notes/todo", DeviceID: phone}, 30*time.Second))
+}
+
+// TestLeasedStateRepository_RejectsNonHolders tests that enforced leases block other devices' writes
+func TestLeasedStateRepository_RejectsNonHolders(t *testing.T) {
+	pool := getTestPool(t)
+	client := getTestRedisClient(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	leaseRepo := NewRedisLeaseRepository(client)
+	repo := NewLeasedEncryptedStateRepository(NewPostgresEncryptedStateRepository(pool, quotaRepo), leaseRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, holderID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+	defer cleanupTestLeases(t, client, ctx)
+
+	other := &models.Device{AccountID: accountID, Name: "Other Device", DeviceType: "mobile"}
+	require.NoError(t, deviceRepo.Create(ctx, other))
+
+	require.NoError(t, leaseRepo.Acquire(ctx, &models.Lease{AccountID: accountID, Key: "doc", DeviceID: holderID, Enforced: true}, time.Minute))
+	require.NoError(t, leaseRepo.Acquire(ctx, &models.Lease{AccountID: accountID, Key: "draft", DeviceID: holderID}, time.Minute))
+
+	// ACT: The other device writes both keys
+	err := repo.Upsert(ctx, &models.EncryptedState{AccountID: accountID, DeviceID: other.ID, Key: "doc", State: []byte("x"), Nonce: []byte("n")})
+
+	// ASSERT: The enforced lease blocks the write; the advisory one doesn't
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+	_, err = repo.GetByKey(ctx, accountID, "doc")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = repo.Upsert(ctx, &models.EncryptedState{AccountID: accountID, DeviceID: other.ID, Key: "draft", State: []byte("x"), Nonce: []byte("n")})
+	assert.NoError(t, err)
+
+	// The holder can still write
+	err = repo.Upsert(ctx, &models.EncryptedState{AccountID: accountID, DeviceID: holderID, Key: "doc", State: []byte("y"), Nonce: []byte("n")})
+	assert.NoError(t, err)
+}
+
+// cleanupTestLeases removes test leases
+func cleanupTestLeases(t *testing.T, client *redis.Client, ctx context.Context) {
+	keys, err := client.Keys(ctx, leasePrefix+"*").Result()
+	if err != nil {
+		t.Logf("Warning: failed to get keys: %v", err)
+		return
+	}
+	if len(keys) > 0 {
+		client.Del(ctx, keys...)
+	}
+}
@@ -0,0 +1,255 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+var (
+	// ErrStaleSnapshot is returned when a snapshot at or after the given position already exists
+	ErrStaleSnapshot = errors.New("a snapshot at or after this position has already been published")
+	// ErrSnapshotAhead is returned when a snapshot claims ops that haven't been appended yet
+	ErrSnapshotAhead = errors.New("snapshot position is past the end of the op log")
+)
+
+// PostgresOpLogRepository stores per-key append-only op logs. Appends never
+// conflict: the log's head row hands out positions, and its row lock makes
+// them gapless and totally ordered per key.
+type PostgresOpLogRepository struct {
+	pool   *pgxpool.Pool
+	quotas *PostgresQuotaRepository
+}
+
+func NewPostgresOpLogRepository(pool *pgxpool.Pool, quotas *PostgresQuotaRepository) *PostgresOpLogRepository {
+	return &PostgresOpLogRepository{pool: pool, quotas: quotas}
+}
+
+// Append adds ops, which must all be for the same account, device and key,
+// to the end of the key's log, creating the log on first use. Each op's
+// Position and CreatedAt are set. A single ops sync event carrying the last
+// position is appended with them, and the account is charged for the ops'
+// bytes and one event.
+func (r *PostgresOpLogRepository) Append(ctx context.Context, ops []*models.StateOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	first := ops[0]
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Reserve positions; the row lock holds off other appenders until commit
+	query := `INSERT INTO op_log_heads (account_id, key, position)
+	          VALUES ($1, $2, $3)
+	          ON CONFLICT (account_id, key) DO UPDATE
+	          SET position = op_log_heads.position + EXCLUDED.position, updated_at = NOW()
+	          RETURNING position`
+
+	var last int64
+	if err := tx.QueryRow(ctx, query, first.AccountID, first.Key, len(ops)).Scan(&last); err != nil {
+		return fmt.Errorf("failed to reserve op positions: %w", err)
+	}
+
+	query = `INSERT INTO state_ops (account_id, key, position, device_id, op, nonce)
+	         VALUES ($1, $2, $3, $4, $5, $6)
+	         RETURNING created_at`
+
+	delta := usageDelta{Events: 1}
+	position := last - int64(len(ops))
+	for _, op := range ops {
+		position++
+		err := tx.QueryRow(ctx, query, op.AccountID, op.Key, position, op.DeviceID, op.Op, op.Nonce).Scan(&op.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to append op: %w", err)
+		}
+		op.Position = position
+
+		size := int64(len(op.Op) + len(op.Nonce))
+		delta.Bytes += size
+		delta.BlobSize = max(delta.BlobSize, size)
+	}
+
+	// Charged before the event is numbered, like every event write (see AppendTx)
+	if err := r.quotas.charge(ctx, tx, first.AccountID, delta); err != nil {
+		return err
+	}
+
+	event := &models.SyncEvent{
+		AccountID:    first.AccountID,
+		DeviceID:     first.DeviceID,
+		EventType:    models.EventTypeOps,
+		StateKey:     first.Key,
+		StateVersion: last,
+	}
+	if err := insertSyncEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit ops: %w", err)
+	}
+	return nil
+}
+
+// ListAfter returns up to limit ops of a key with a position after the given one, in order.
+func (r *PostgresOpLogRepository) ListAfter(ctx context.Context, accountID uuid.UUID, key string, after int64, limit int) ([]*models.StateOp, error) {
+	query := `SELECT account_id, device_id, key, position, op, nonce, created_at
+	          FROM state_ops
+	          WHERE account_id = $1 AND key = $2 AND position > $3
+	          ORDER BY position ASC
+	          LIMIT $4`
+
+	rows, err := r.pool.Query(ctx, query, accountID, key, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ops: %w", err)
+	}
+	defer rows.Close()
+
+	ops := []*models.StateOp{}
+	for rows.Next() {
+		var op models.StateOp
+		err := rows.Scan(&op.AccountID, &op.DeviceID, &op.Key, &op.Position, &op.Op, &op.Nonce, &op.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan op: %w", err)
+		}
+		ops = append(ops, &op)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ops: %w", err)
+	}
+
+	return ops, nil
+}
+
+// GetHead returns a key's last position and snapshot position, or
+// ErrNotFound if nothing was ever appended to it.
+func (r *PostgresOpLogRepository) GetHead(ctx context.Context, accountID uuid.UUID, key string) (*models.OpLogHead, error) {
+	query := `SELECT key, position, snapshot_position
+	          FROM op_log_heads
+	          WHERE account_id = $1 AND key = $2`
+
+	var head models.OpLogHead
+	err := r.pool.QueryRow(ctx, query, accountID, key).Scan(&head.Key, &head.Position, &head.SnapshotPosition)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get op log head: %w", err)
+	}
+	return &head, nil
+}
+
+// GetSnapshot returns a key's latest snapshot, or ErrNotFound if none was published.
+func (r *PostgresOpLogRepository) GetSnapshot(ctx context.Context, accountID uuid.UUID, key string) (*models.OpSnapshot, error) {
+	query := `SELECT account_id, snapshot_device_id, key, snapshot_position, snapshot, snapshot_nonce, snapshot_at
+	          FROM op_log_heads
+	          WHERE account_id = $1 AND key = $2 AND snapshot IS NOT NULL`
+
+	var snapshot models.OpSnapshot
+	err := r.pool.QueryRow(ctx, query, accountID, key).Scan(
+		&snapshot.AccountID,
+		&snapshot.DeviceID,
+		&snapshot.Key,
+		&snapshot.Position,
+		&snapshot.Snapshot,
+		&snapshot.Nonce,
+		&snapshot.CreatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// PublishSnapshot replaces a key's snapshot and drops the ops it covers.
+// snapshot.Position must be after the current snapshot (ErrStaleSnapshot)
+// and no later than the last appended op (ErrSnapshotAhead). Usage is
+// adjusted by the difference between the new snapshot and what it replaces.
+func (r *PostgresOpLogRepository) PublishSnapshot(ctx context.Context, snapshot *models.OpSnapshot) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT position, snapshot_position,
+	                 COALESCE(octet_length(snapshot) + octet_length(snapshot_nonce), 0)
+	          FROM op_log_heads
+	          WHERE account_id = $1 AND key = $2
+	          FOR UPDATE`
+
+	var position, snapshotPosition, oldSize int64
+	err = tx.QueryRow(ctx, query, snapshot.AccountID, snapshot.Key).Scan(&position, &snapshotPosition, &oldSize)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get op log head: %w", err)
+	}
+	if snapshot.Position > position {
+		return ErrSnapshotAhead
+	}
+	if snapshot.Position <= snapshotPosition {
+		return ErrStaleSnapshot
+	}
+
+	query = `WITH dropped AS (
+	             DELETE FROM state_ops
+	             WHERE account_id = $1 AND key = $2 AND position <= $3
+	             RETURNING octet_length(op) + octet_length(nonce) AS size
+	         )
+	         SELECT COALESCE(SUM(size), 0) FROM dropped`
+
+	var droppedSize int64
+	if err := tx.QueryRow(ctx, query, snapshot.AccountID, snapshot.Key, snapshot.Position).Scan(&droppedSize); err != nil {
+		return fmt.Errorf("failed to drop compacted ops: %w", err)
+	}
+
+	query = `UPDATE op_log_heads
+	         SET snapshot_position = $3,
+	             snapshot = $4,
+	             snapshot_nonce = $5,
+	             snapshot_device_id = $6,
+	             snapshot_at = NOW(),
+	             updated_at = NOW()
+	         WHERE account_id = $1 AND key = $2
+	         RETURNING snapshot_at`
+
+	err = tx.QueryRow(ctx, query,
+		snapshot.AccountID,
+		snapshot.Key,
+		snapshot.Position,
+		snapshot.Snapshot,
+		snapshot.Nonce,
+		snapshot.DeviceID,
+	).Scan(&snapshot.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+
+	newSize := int64(len(snapshot.Snapshot) + len(snapshot.Nonce))
+	delta := usageDelta{Bytes: newSize - oldSize - droppedSize, BlobSize: newSize}
+	if err := r.quotas.charge(ctx, tx, snapshot.AccountID, delta); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpLogRepository_AppendAndCompact tests that ops get consecutive positions
+// and that a snapshot drops the ops it covers
+func TestOpLogRepository_AppendAndCompact(t *testing.T) {
+	pool := getTestPool(t)
+	repo := NewPostgresOpLogRepository(pool, NewPostgresQuotaRepository(pool, models.QuotaLimits{}))
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	newOp := func(data string) *models.StateOp {
+		return &models.StateOp{AccountID: accountID, DeviceID: deviceID, Key: "doc", Op: []byte(data), Nonce: []byte("n")}
+	}
+
+	// ARRANGE: Two appends, without versions
+	first := []*models.StateOp{newOp("a"), newOp("b")}
+	require.NoError(t, repo.Append(ctx, first))
+	second := []*models.StateOp{newOp("c")}
+	require.NoError(t, repo.Append(ctx, second))
+
+	// ACT: Compact the first two ops
+	snapshot := &models.OpSnapshot{AccountID: accountID, DeviceID: deviceID, Key: "doc", Position: 2, Snapshot: []byte("ab"), Nonce: []byte("n")}
+	err := repo.PublishSnapshot(ctx, snapshot)
+
+	// ASSERT: Positions are consecutive, and only the uncompacted op remains
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first[0].Position)
+	assert.Equal(t, int64(2), first[1].Position)
+	assert.Equal(t, int64(3), second[0].Position)
+
+	ops, err := repo.ListAfter(ctx, accountID, "doc", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, []byte("c"), ops[0].Op)
+
+	head, err := repo.GetHead(ctx, accountID, "doc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), head.Position)
+	assert.Equal(t, int64(2), head.SnapshotPosition)
+
+	stored, err := repo.GetSnapshot(ctx, accountID, "doc")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ab"), stored.Snapshot)
+
+	// Older and not-yet-appended snapshots are rejected
+	stale := &models.OpSnapshot{AccountID: accountID, DeviceID: deviceID, Key: "doc", Position: 1, Snapshot: []byte("a"), Nonce: []byte("n")}
+	assert.ErrorIs(t, repo.PublishSnapshot(ctx, stale), ErrStaleSnapshot)
+	ahead := &models.OpSnapshot{AccountID: accountID, DeviceID: deviceID, Key: "doc", Position: 4, Snapshot: []byte("abcd"), Nonce: []byte("n")}
+	assert.ErrorIs(t, repo.PublishSnapshot(ctx, ahead), ErrSnapshotAhead)
+}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// ErrQuotaExceeded is returned when a write would take an account over one of its limits
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// usageDelta is a change to an account's usage, applied by charge.
+type usageDelta struct {
+	Bytes  int64
+	Keys   int64
+	Events int64
+	// BlobSize is the size of the blob being written, checked against MaxBlobSize.
+	BlobSize int64
+}
+
+// PostgresQuotaRepository keeps per-account usage counters and limits. Limits
+// default to the configured values and can be overridden per account.
+// Repositories that write account data call charge inside their own
+// transaction, so usage always matches what was committed.
+type PostgresQuotaRepository struct {
+	pool     *pgxpool.Pool
+	defaults models.QuotaLimits
+}
+
+func NewPostgresQuotaRepository(pool *pgxpool.Pool, defaults models.QuotaLimits) *PostgresQuotaRepository {
+	return &PostgresQuotaRepository{pool: pool, defaults: defaults}
+}
+
+// GetLimits returns the effective limits for an account.
+func (r *PostgresQuotaRepository) GetLimits(ctx context.Context, accountID uuid.UUID) (*models.QuotaLimits, error) {
+	return r.getLimits(ctx, r.pool, accountID)
+}
+
+// SetLimits stores per-account limits that override the defaults.
+func (r *PostgresQuotaRepository) SetLimits(ctx context.Context, accountID uuid.UUID, limits *models.QuotaLimits) error {
+	query := `INSERT INTO account_quotas (account_id, max_bytes, max_keys, max_blob_size, max_events_per_day)
+	          VALUES ($1, $2, $3, $4, $5)
+	          ON CONFLICT (account_id) DO UPDATE
+	          SET max_bytes = EXCLUDED.max_bytes,
+	              max_keys = EXCLUDED.max_keys,
+	              max_blob_size = EXCLUDED.max_blob_size,
+	              max_events_per_day = EXCLUDED.max_events_per_day,
+	              updated_at = NOW()`
+
+	_, err := r.pool.Exec(ctx, query,
+		accountID,
+		limits.MaxBytes,
+		limits.MaxKeys,
+		limits.MaxBlobSize,
+		limits.MaxEventsPerDay,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set quota limits: %w", err)
+	}
+	return nil
+}
+
+// GetUsage returns the current usage for an account. Accounts that have
+// never written anything report zero usage.
+func (r *PostgresQuotaRepository) GetUsage(ctx context.Context, accountID uuid.UUID) (*models.AccountUsage, error) {
+	query := `SELECT bytes_used, key_count,
+	                 CASE WHEN events_day = (NOW() AT TIME ZONE 'UTC')::date THEN events_today ELSE 0 END,
+	                 updated_at
+	          FROM account_usage
+	          WHERE account_id = $1`
+
+	usage := models.AccountUsage{AccountID: accountID}
+	err := r.pool.QueryRow(ctx, query, accountID).Scan(
+		&usage.BytesUsed,
+		&usage.KeyCount,
+		&usage.EventsToday,
+		&usage.UpdatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &usage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &usage, nil
+}
+
+func (r *PostgresQuotaRepository) getLimits(ctx context.Context, db DBTX, accountID uuid.UUID) (*models.QuotaLimits, error) {
+	query := `SELECT max_bytes, max_keys, max_blob_size, max_events_per_day
+	          FROM account_quotas
+	          WHERE account_id = $1`
+
+	var maxBytes, maxKeys, maxBlobSize, maxEventsPerDay *int64
+	err := db.QueryRow(ctx, query, accountID).Scan(&maxBytes, &maxKeys, &maxBlobSize, &maxEventsPerDay)
+
+	limits := r.defaults
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &limits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota limits: %w", err)
+	}
+
+	// NULL columns fall back to the defaults
+	if maxBytes != nil {
+		limits.MaxBytes = *maxBytes
+	}
+	if maxKeys != nil {
+		limits.MaxKeys = *maxKeys
+	}
+	if maxBlobSize != nil {
+		limits.MaxBlobSize = *maxBlobSize
+	}
+	if maxEventsPerDay != nil {
+		limits.MaxEventsPerDay = *maxEventsPerDay
+	}
+	return &limits, nil
+}
+
+// charge applies delta to the account's usage within tx and returns
+// ErrQuotaExceeded if the result is over a limit. The caller must roll back
+// tx on error. Only dimensions that grow are checked, so deletes and shrinking
+// writes always succeed even for an account that is already over quota.
+// The usage row lock serializes concurrent writers of the same account.
+func (r *PostgresQuotaRepository) charge(ctx context.Context, tx pgx.Tx, accountID uuid.UUID, delta usageDelta) error {
+	limits, err := r.getLimits(ctx, tx, accountID)
+	if err != nil {
+		return err
+	}
+
+	if exceeds(delta.BlobSize, limits.MaxBlobSize) {
+		return fmt.Errorf("%w: blob size %d exceeds limit of %d bytes", ErrQuotaExceeded, delta.BlobSize, limits.MaxBlobSize)
+	}
+
+	query := `INSERT INTO account_usage (account_id, bytes_used, key_count, events_today)
+	          VALUES ($1, $2, $3, $4)
+	          ON CONFLICT (account_id) DO UPDATE
+	          SET bytes_used = account_usage.bytes_used + EXCLUDED.bytes_used,
+	              key_count = account_usage.key_count + EXCLUDED.key_count,
+	              events_today = CASE
+	                  WHEN account_usage.events_day = (NOW() AT TIME ZONE 'UTC')::date THEN account_usage.events_today
+	                  ELSE 0
+	              END + EXCLUDED.events_today,
+	              events_day = (NOW() AT TIME ZONE 'UTC')::date,
+	              updated_at = NOW()
+	          RETURNING bytes_used, key_count, events_today`
+
+	var bytesUsed, keyCount, eventsToday int64
+	err = tx.QueryRow(ctx, query,
+		accountID,
+		delta.Bytes,
+		delta.Keys,
+		delta.Events,
+	).Scan(&bytesUsed, &keyCount, &eventsToday)
+	if err != nil {
+		return fmt.Errorf("failed to update usage: %w", err)
+	}
+
+	if delta.Bytes > 0 && exceeds(bytesUsed, limits.MaxBytes) {
+		return fmt.Errorf("%w: storage limit of %d bytes reached", ErrQuotaExceeded, limits.MaxBytes)
+	}
+	if delta.Keys > 0 && exceeds(keyCount, limits.MaxKeys) {
+		return fmt.Errorf("%w: limit of %d keys reached", ErrQuotaExceeded, limits.MaxKeys)
+	}
+	if delta.Events > 0 && exceeds(eventsToday, limits.MaxEventsPerDay) {
+		return fmt.Errorf("%w: limit of %d events per day reached", ErrQuotaExceeded, limits.MaxEventsPerDay)
+	}
+	return nil
+}
+
+// exceeds reports whether value is over limit, treating a zero limit as unlimited.
+func exceeds(value, limit int64) bool {
+	return limit > 0 && value > limit
+}
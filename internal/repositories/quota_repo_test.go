@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQuotaRepository_UsageTracksWrites tests that usage follows creates, updates and deletes
+func TestQuotaRepository_UsageTracksWrites(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// Create a 10 byte state (8 bytes state + 2 bytes nonce)
+	state := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Key:       "usage",
+		State:     []byte("12345678"),
+		Nonce:     []byte("n1"),
+	}
+	require.NoError(t, repo.Upsert(ctx, state))
+
+	usage, err := quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), usage.BytesUsed)
+	assert.Equal(t, int64(1), usage.KeyCount)
+
+	// Shrink it to 4 bytes
+	state.State = []byte("12")
+	require.NoError(t, repo.Upsert(ctx, state))
+
+	usage, err = quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), usage.BytesUsed, "Update should charge only the difference")
+
+	// ACT: Delete it
+	err = repo.Delete(ctx, state)
+
+	// ASSERT: Usage is released
+	require.NoError(t, err)
+	usage, err = quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.BytesUsed)
+	assert.Equal(t, int64(0), usage.KeyCount)
+}
+
+// TestQuotaRepository_RejectsWritesOverLimit tests that a write over quota is rejected and not applied
+func TestQuotaRepository_RejectsWritesOverLimit(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{MaxKeys: 1, MaxBlobSize: 16})
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	first := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "first", State: []byte("a"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, first))
+
+	// ACT: Second key goes over MaxKeys, oversized blob goes over MaxBlobSize
+	second := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "second", State: []byte("b"), Nonce: []byte("n")}
+	errKeys := repo.Upsert(ctx, second)
+
+	first.State = make([]byte, 17)
+	errBlob := repo.Upsert(ctx, first)
+
+	// ASSERT: Both are rejected and nothing was written
+	assert.ErrorIs(t, errKeys, ErrQuotaExceeded)
+	assert.ErrorIs(t, errBlob, ErrQuotaExceeded)
+
+	_, err := repo.GetByKey(ctx, accountID, "second")
+	assert.ErrorIs(t, err, ErrNotFound, "Rejected state should not be stored")
+
+	usage, err := quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), usage.KeyCount)
+	assert.Equal(t, int64(2), usage.BytesUsed)
+}
+
+// TestQuotaRepository_LimitsChunkedBlobSize tests that a chunked state's chunks count towards the blob size limit
+func TestQuotaRepository_LimitsChunkedBlobSize(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{MaxBlobSize: 16})
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	chunkRepo := NewPostgresChunkRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// ARRANGE: Two chunks, each under the limit but not together
+	require.NoError(t, chunkRepo.Put(ctx, &models.Chunk{AccountID: accountID, Hash: "hash-a", Data: make([]byte, 10)}))
+	require.NoError(t, chunkRepo.Put(ctx, &models.Chunk{AccountID: accountID, Hash: "hash-b", Data: make([]byte, 10)}))
+
+	// ACT: Reference one, then both
+	small := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "small", Nonce: []byte("n"), Chunks: []string{"hash-a"}}
+	errSmall := repo.Upsert(ctx, small)
+	large := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "large", Nonce: []byte("n"), Chunks: []string{"hash-a", "hash-b"}}
+	errLarge := repo.Upsert(ctx, large)
+
+	// ASSERT: Only the state over the limit is rejected
+	assert.NoError(t, errSmall)
+	assert.ErrorIs(t, errLarge, ErrQuotaExceeded)
+
+	_, err := repo.GetByKey(ctx, accountID, "large")
+	assert.ErrorIs(t, err, ErrNotFound, "Rejected state should not be stored")
+}
@@ -0,0 +1,274 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// ErrAccessDenied is returned when a grantee's share does not allow the operation
+var ErrAccessDenied = errors.New("access denied: share does not allow this operation")
+
+// shareColumns is the column list every share query selects, in scanShare
+// order. Queries join encrypted_states as s for the key.
+const shareColumns = `g.id, g.state_id, g.owner_account_id, g.grantee_account_id, s.key, g.permission,
+	g.wrapped_key, g.expires_at, g.created_at, g.updated_at`
+
+// activeShare matches shares (aliased g) that have not expired.
+const activeShare = `(g.expires_at IS NULL OR g.expires_at > NOW())`
+
+// PostgresShareRepository stores grants that let other accounts read or
+// write individual states. Granting and revoking notify the grantee through
+// their own sync event stream.
+type PostgresShareRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresShareRepository(pool *pgxpool.Pool) *PostgresShareRepository {
+	return &PostgresShareRepository{pool: pool}
+}
+
+// Grant shares the live state share.StateID with share.GranteeAccountID, or
+// replaces the permission, wrapped key and expiry of an existing grant.
+// share.StateKey and the generated fields are populated on success.
+func (r *PostgresShareRepository) Grant(ctx context.Context, share *models.StateShare) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the state so a concurrent delete can't slip between check and grant
+	var version int64
+	var scoped bool
+	query := `SELECT key, version, visible_to IS NOT NULL FROM encrypted_states
+	          WHERE id = $1 AND account_id = $2 AND ` + liveState + `
+	          FOR SHARE`
+	err = tx.QueryRow(ctx, query, share.StateID, share.OwnerAccountID).Scan(&share.StateKey, &version, &scoped)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check shared state: %w", err)
+	}
+	if scoped {
+		return fmt.Errorf("%w: device-scoped states can't be shared", ErrInvalidVisibility)
+	}
+
+	query = `INSERT INTO state_shares (state_id, owner_account_id, grantee_account_id, permission, wrapped_key, expires_at)
+	         VALUES ($1, $2, $3, $4, $5, $6)
+	         ON CONFLICT (state_id, grantee_account_id) DO UPDATE
+	         SET permission = EXCLUDED.permission,
+	             wrapped_key = EXCLUDED.wrapped_key,
+	             expires_at = EXCLUDED.expires_at,
+	             updated_at = NOW()
+	         RETURNING id, created_at, updated_at`
+
+	err = tx.QueryRow(ctx, query,
+		share.StateID,
+		share.OwnerAccountID,
+		share.GranteeAccountID,
+		share.Permission,
+		share.WrappedKey,
+		share.ExpiresAt,
+	).Scan(&share.ID, &share.CreatedAt, &share.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to grant share: %w", err)
+	}
+
+	event := &models.SyncEvent{
+		AccountID:      share.GranteeAccountID,
+		OwnerAccountID: &share.OwnerAccountID,
+		EventType:      models.EventTypeShare,
+		StateKey:       share.StateKey,
+		StateVersion:   version,
+	}
+	if err := insertSyncEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit share: %w", err)
+	}
+	return nil
+}
+
+// Revoke removes the owner's grant on a state to a grantee. The grantee keeps
+// whatever content key it already unwrapped; owners who need to cut off
+// access to future versions must rotate the content key.
+func (r *PostgresShareRepository) Revoke(ctx context.Context, ownerID, stateID, granteeID uuid.UUID) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM state_shares g
+	          USING encrypted_states s
+	          WHERE g.state_id = s.id
+	            AND g.state_id = $1 AND g.owner_account_id = $2 AND g.grantee_account_id = $3
+	          RETURNING s.key, s.version`
+
+	var key string
+	var version int64
+	err = tx.QueryRow(ctx, query, stateID, ownerID, granteeID).Scan(&key, &version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+
+	event := &models.SyncEvent{
+		AccountID:      granteeID,
+		OwnerAccountID: &ownerID,
+		EventType:      models.EventTypeUnshare,
+		StateKey:       key,
+		StateVersion:   version,
+	}
+	if err := insertSyncEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit revoke: %w", err)
+	}
+	return nil
+}
+
+// Get returns the grantee's active share on a state.
+func (r *PostgresShareRepository) Get(ctx context.Context, stateID, granteeID uuid.UUID) (*models.StateShare, error) {
+	query := `SELECT ` + shareColumns + `
+	          FROM state_shares g
+	          JOIN encrypted_states s ON s.id = g.state_id
+	          WHERE g.state_id = $1 AND g.grantee_account_id = $2 AND ` + activeShare
+
+	share, err := scanShare(r.pool.QueryRow(ctx, query, stateID, granteeID))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return share, nil
+}
+
+// ListByState returns every grant on one of the owner's states, including expired ones.
+func (r *PostgresShareRepository) ListByState(ctx context.Context, stateID uuid.UUID) ([]*models.StateShare, error) {
+	query := `SELECT ` + shareColumns + `
+	          FROM state_shares g
+	          JOIN encrypted_states s ON s.id = g.state_id
+	          WHERE g.state_id = $1
+	          ORDER BY g.created_at ASC`
+
+	rows, err := r.pool.Query(ctx, query, stateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	return collectShares(rows)
+}
+
+// ListByGrantee returns the active shares other accounts have granted to
+// granteeID on states that still exist.
+func (r *PostgresShareRepository) ListByGrantee(ctx context.Context, granteeID uuid.UUID) ([]*models.StateShare, error) {
+	query := `SELECT ` + shareColumns + `
+	          FROM state_shares g
+	          JOIN encrypted_states s ON s.id = g.state_id
+	          WHERE g.grantee_account_id = $1
+	            AND ` + activeShare + `
+	            AND s.deleted_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW())
+	          ORDER BY g.owner_account_id, s.key COLLATE "C"`
+
+	rows, err := r.pool.Query(ctx, query, granteeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	return collectShares(rows)
+}
+
+// HasChunkAccess reports whether granteeID holds an active share on a live
+// state of ownerID that references the chunk.
+func (r *PostgresShareRepository) HasChunkAccess(ctx context.Context, ownerID, granteeID uuid.UUID, hash string) (bool, error) {
+	query := `SELECT EXISTS (
+	              SELECT 1
+	              FROM state_shares g
+	              JOIN encrypted_states s ON s.id = g.state_id
+	              WHERE g.owner_account_id = $1 AND g.grantee_account_id = $2
+	                AND ` + activeShare + `
+	                AND s.deleted_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW())
+	                AND s.chunks @> ARRAY[$3::text]
+	          )`
+
+	var ok bool
+	if err := r.pool.QueryRow(ctx, query, ownerID, granteeID, hash).Scan(&ok); err != nil {
+		return false, fmt.Errorf("failed to check chunk access: %w", err)
+	}
+	return ok, nil
+}
+
+func scanShare(row pgx.Row) (*models.StateShare, error) {
+	var share models.StateShare
+	err := row.Scan(
+		&share.ID,
+		&share.StateID,
+		&share.OwnerAccountID,
+		&share.GranteeAccountID,
+		&share.StateKey,
+		&share.Permission,
+		&share.WrappedKey,
+		&share.ExpiresAt,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// collectShares scans and closes rows selected with shareColumns.
+func collectShares(rows pgx.Rows) ([]*models.StateShare, error) {
+	defer rows.Close()
+
+	shares := []*models.StateShare{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+// checkWriteShare returns nil if granteeID holds an active read-write share
+// on the state, locking the share so it can't be revoked mid-write.
+func checkWriteShare(ctx context.Context, tx pgx.Tx, stateID, granteeID uuid.UUID) error {
+	query := `SELECT g.permission FROM state_shares g
+	          WHERE g.state_id = $1 AND g.grantee_account_id = $2 AND ` + activeShare + `
+	          FOR SHARE`
+
+	var permission string
+	err := tx.QueryRow(ctx, query, stateID, granteeID).Scan(&permission)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check share: %w", err)
+	}
+	if permission != models.SharePermissionReadWrite {
+		return ErrAccessDenied
+	}
+	return nil
+}
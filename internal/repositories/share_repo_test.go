@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShareRepository_GrantsEnforced tests that reads and writes by another
+// account follow its share, and that the grantee is notified of changes
+func TestShareRepository_GrantsEnforced(t *testing.T) {
+	pool := getTestPool(t)
+	stateRepo := newTestStateRepo(pool)
+	shareRepo := NewPostgresShareRepository(pool)
+	eventRepo := NewPostgresSyncEventRepository(pool, NewPostgresQuotaRepository(pool, models.QuotaLimits{}))
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	ownerID, ownerDevice := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, ownerID)
+	granteeID, granteeDevice := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, granteeID)
+
+	state := &models.EncryptedState{
+		AccountID: ownerID,
+		DeviceID:  ownerDevice,
+		Key:       "notes/shared",
+		State:     []byte("v1"),
+		Nonce:     []byte("nonce"),
+	}
+	require.NoError(t, stateRepo.Upsert(ctx, state))
+
+	// ARRANGE: Nothing is visible before the state is shared
+	_, err := stateRepo.GetByKeyAs(ctx, granteeID, ownerID, "notes/shared")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	share := &models.StateShare{
+		StateID:          state.ID,
+		OwnerAccountID:   ownerID,
+		GranteeAccountID: granteeID,
+		Permission:       models.SharePermissionRead,
+		WrappedKey:       []byte("wrapped"),
+	}
+	require.NoError(t, shareRepo.Grant(ctx, share))
+
+	// ACT: Read, then try to write with a read-only share
+	read, readErr := stateRepo.GetByKeyAs(ctx, granteeID, ownerID, "notes/shared")
+	write := &models.EncryptedState{
+		AccountID: ownerID,
+		DeviceID:  granteeDevice,
+		Key:       "notes/shared",
+		State:     []byte("v2"),
+		Nonce:     []byte("nonce"),
+		Version:   1,
+	}
+	readOnlyErr := stateRepo.UpsertAs(ctx, granteeID, write)
+
+	// ASSERT: Reading works, writing is denied
+	require.NoError(t, readErr)
+	assert.Equal(t, []byte("v1"), read.State)
+	assert.ErrorIs(t, readOnlyErr, ErrAccessDenied)
+
+	// Upgrading the share allows the write, and the owner's version sequence continues
+	share.Permission = models.SharePermissionReadWrite
+	require.NoError(t, shareRepo.Grant(ctx, share))
+	require.NoError(t, stateRepo.UpsertAs(ctx, granteeID, write))
+	assert.Equal(t, int64(2), write.Version)
+
+	owned, err := stateRepo.GetByKey(ctx, ownerID, "notes/shared")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), owned.State)
+
+	// Grantees can't create keys in the owner's account
+	create := &models.EncryptedState{AccountID: ownerID, DeviceID: granteeDevice, Key: "notes/new", State: []byte("x"), Nonce: []byte("n")}
+	assert.ErrorIs(t, stateRepo.UpsertAs(ctx, granteeID, create), ErrNotFound)
+
+	// Revoking removes access
+	require.NoError(t, shareRepo.Revoke(ctx, ownerID, state.ID, granteeID))
+	_, err = stateRepo.GetByKeyAs(ctx, granteeID, ownerID, "notes/shared")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// The grantee's stream saw the grant, its upgrade and the revoke
+	events, err := eventRepo.GetByAccountID(ctx, granteeID)
+	require.NoError(t, err)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.EventType)
+		require.NotNil(t, event.OwnerAccountID)
+		assert.Equal(t, ownerID, *event.OwnerAccountID)
+		assert.Equal(t, "notes/shared", event.StateKey)
+	}
+	assert.Equal(t, []string{
+		models.EventTypeShare,
+		models.EventTypeShare,
+		models.EventTypeUnshare,
+	}, types)
+}
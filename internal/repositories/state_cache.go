@@ -0,0 +1,282 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const stateCachePrefix = "state-cache:"
+const stateCacheIDPrefix = "state-cache-id:"
+
+// cacheStoreScript stores "version:payload" at KEYS[1] unless the cache
+// already holds something newer. ARGV: version, payload ('' for an
+// invalidation marker), TTL in ms. Data may replace a marker of the same
+// version (the write it marks has been read back); nothing else may replace
+// an entry of the same or a later version.
+var cacheStoreScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current then
+	local sep = string.find(current, ':', 1, true)
+	local version = tonumber(string.sub(current, 1, sep - 1))
+	local new = tonumber(ARGV[1])
+	local isMarker = sep == string.len(current)
+	if version > new or (version == new and not (isMarker and ARGV[2] ~= '')) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1] .. ':' .. ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// CacheStats reports how well the state cache is doing.
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// CachedEncryptedStateRepository is a read-through Redis cache in front of
+// another EncryptedStateRepository. It serves GetByKey and GetByID from
+// Redis and passes everything else through.
+//
+// The cache lives in the shared Redis, so every server instance sees the
+// same entries. Writes replace the entry with an invalidation marker
+// carrying the new version, and entries are only ever replaced by newer
+// versions, so a slow reader can't re-cache a state that was changed or
+// deleted after it read from Postgres. If Redis is unavailable reads fall
+// back to Postgres; a failed invalidation is logged and heals within ttl.
+type CachedEncryptedStateRepository struct {
+	EncryptedStateRepository
+	client      *redis.Client
+	ttl         time.Duration
+	maxBlobSize int
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewCachedEncryptedStateRepository caches states from next for ttl. States
+// whose inline state and nonce exceed maxBlobSize bytes are not cached.
+func NewCachedEncryptedStateRepository(next EncryptedStateRepository, client *redis.Client, ttl time.Duration, maxBlobSize int) *CachedEncryptedStateRepository {
+	return &CachedEncryptedStateRepository{
+		EncryptedStateRepository: next,
+		client:                   client,
+		ttl:                      ttl,
+		maxBlobSize:              maxBlobSize,
+	}
+}
+
+// Stats returns the cache's hit and miss counts since startup.
+func (r *CachedEncryptedStateRepository) Stats() CacheStats {
+	stats := CacheStats{Hits: r.hits.Load(), Misses: r.misses.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+func (r *CachedEncryptedStateRepository) GetByKey(ctx context.Context, accountID uuid.UUID, key string) (*models.EncryptedState, error) {
+	if state := r.lookup(ctx, stateCacheKey(accountID, key)); state != nil {
+		r.hits.Add(1)
+		return state, nil
+	}
+	r.misses.Add(1)
+
+	state, err := r.EncryptedStateRepository.GetByKey(ctx, accountID, key)
+	if err != nil {
+		return nil, err
+	}
+	r.fill(ctx, state)
+	return state, nil
+}
+
+func (r *CachedEncryptedStateRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EncryptedState, error) {
+	// IDs never move between keys, so the ID index needs no invalidation
+	pointer, err := r.client.Get(ctx, stateCacheIDPrefix+id.String()).Result()
+	if err == nil {
+		accountID, key, ok := strings.Cut(pointer, ":")
+		if parsed, parseErr := uuid.Parse(accountID); ok && parseErr == nil {
+			return r.GetByKey(ctx, parsed, key)
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("state cache: failed to read ID index: %v", err)
+	}
+	r.misses.Add(1)
+
+	state, err := r.EncryptedStateRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.fill(ctx, state)
+	return state, nil
+}
+
+func (r *CachedEncryptedStateRepository) GetByKeyAs(ctx context.Context, actorID, ownerID uuid.UUID, key string) (*models.EncryptedState, error) {
+	if actorID == ownerID {
+		return r.GetByKey(ctx, ownerID, key)
+	}
+	return r.EncryptedStateRepository.GetByKeyAs(ctx, actorID, ownerID, key)
+}
+
+func (r *CachedEncryptedStateRepository) Upsert(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.Upsert(ctx, state); err != nil {
+		return err
+	}
+	r.invalidate(ctx, state)
+	return nil
+}
+
+func (r *CachedEncryptedStateRepository) UpsertAs(ctx context.Context, actorID uuid.UUID, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.UpsertAs(ctx, actorID, state); err != nil {
+		return err
+	}
+	r.invalidate(ctx, state)
+	return nil
+}
+
+// UpsertTx invalidates the cached entry once tx commits, as do the other Tx
+// writes.
+func (r *CachedEncryptedStateRepository) UpsertTx(ctx context.Context, tx *Tx, actorID uuid.UUID, state *models.EncryptedState) (string, error) {
+	eventType, err := r.EncryptedStateRepository.UpsertTx(ctx, tx, actorID, state)
+	if err != nil {
+		return "", err
+	}
+	r.invalidateOnCommit(ctx, tx, state)
+	return eventType, nil
+}
+
+func (r *CachedEncryptedStateRepository) Delete(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.Delete(ctx, state); err != nil {
+		return err
+	}
+	r.invalidate(ctx, state)
+	return nil
+}
+
+func (r *CachedEncryptedStateRepository) DeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.DeleteTx(ctx, tx, state); err != nil {
+		return err
+	}
+	r.invalidateOnCommit(ctx, tx, state)
+	return nil
+}
+
+func (r *CachedEncryptedStateRepository) Undelete(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.Undelete(ctx, state); err != nil {
+		return err
+	}
+	r.invalidate(ctx, state)
+	return nil
+}
+
+func (r *CachedEncryptedStateRepository) UndeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
+	if err := r.EncryptedStateRepository.UndeleteTx(ctx, tx, state); err != nil {
+		return err
+	}
+	r.invalidateOnCommit(ctx, tx, state)
+	return nil
+}
+
+func (r *CachedEncryptedStateRepository) ReapExpired(ctx context.Context, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error) {
+	reaped, err := r.EncryptedStateRepository.ReapExpired(ctx, accountID, limit)
+	for _, state := range reaped {
+		r.invalidate(ctx, state)
+	}
+	return reaped, err
+}
+
+func (r *CachedEncryptedStateRepository) ReapExpiredTx(ctx context.Context, tx *Tx, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error) {
+	reaped, err := r.EncryptedStateRepository.ReapExpiredTx(ctx, tx, accountID, limit)
+	for _, state := range reaped {
+		r.invalidateOnCommit(ctx, tx, state)
+	}
+	return reaped, err
+}
+
+// lookup returns the cached state, or nil on a miss, a marker or any error.
+func (r *CachedEncryptedStateRepository) lookup(ctx context.Context, cacheKey string) *models.EncryptedState {
+	value, err := r.client.Get(ctx, cacheKey).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("state cache: failed to read: %v", err)
+		}
+		return nil
+	}
+
+	_, payload, _ := strings.Cut(value, ":")
+	if payload == "" {
+		return nil
+	}
+
+	var state models.EncryptedState
+	if err := json.Unmarshal([]byte(payload), &state); err != nil {
+		log.Printf("state cache: bad entry at %s: %v", cacheKey, err)
+		return nil
+	}
+	// Entries never outlive the state's expiry, but clocks may differ slightly
+	if state.ExpiresAt != nil && !state.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	return &state
+}
+
+// fill caches a state read from the underlying repository.
+func (r *CachedEncryptedStateRepository) fill(ctx context.Context, state *models.EncryptedState) {
+	if len(state.State)+len(state.Nonce) > r.maxBlobSize {
+		return
+	}
+	ttl := r.ttl
+	if state.ExpiresAt != nil {
+		ttl = min(ttl, time.Until(*state.ExpiresAt))
+	}
+	if ttl < time.Millisecond {
+		return
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("state cache: failed to encode state: %v", err)
+		return
+	}
+
+	err = cacheStoreScript.Run(ctx, r.client, []string{stateCacheKey(state.AccountID, state.Key)},
+		state.Version, payload, ttl.Milliseconds()).Err()
+	if err != nil {
+		log.Printf("state cache: failed to store state: %v", err)
+		return
+	}
+	err = r.client.Set(ctx, stateCacheIDPrefix+state.ID.String(), state.AccountID.String()+":"+state.Key, r.ttl).Err()
+	if err != nil {
+		log.Printf("state cache: failed to index state ID: %v", err)
+	}
+}
+
+// invalidate marks the cached entry for a written state as stale up to its new version.
+func (r *CachedEncryptedStateRepository) invalidate(ctx context.Context, state *models.EncryptedState) {
+	err := cacheStoreScript.Run(ctx, r.client, []string{stateCacheKey(state.AccountID, state.Key)},
+		state.Version, "", r.ttl.Milliseconds()).Err()
+	if err != nil {
+		log.Printf("state cache: failed to invalidate %s: %v", state.Key, err)
+	}
+}
+
+// invalidateOnCommit invalidates the cached entry for state once tx commits.
+// A copy is taken, since callers may reuse state before then.
+func (r *CachedEncryptedStateRepository) invalidateOnCommit(ctx context.Context, tx *Tx, state *models.EncryptedState) {
+	written := *state
+	tx.OnCommit(func() { r.invalidate(ctx, &written) })
+}
+
+func stateCacheKey(accountID uuid.UUID, key string) string {
+	return fmt.Sprintf("%s%s:%s", stateCachePrefix, accountID, key)
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCachedStateRepository_ReadThroughAndInvalidate tests that repeated reads
+// are served from Redis and that a write is never hidden by a cached entry
+func TestCachedStateRepository_ReadThroughAndInvalidate(t *testing.T) {
+	pool := getTestPool(t)
+	client := getTestRedisClient(t)
+	repo := NewCachedEncryptedStateRepository(
+		newTestStateRepo(pool),
+		client, time.Minute, 1024,
+	)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+	defer client.Del(ctx, stateCacheKey(accountID, "settings"))
+
+	state := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "settings", State: []byte("v1"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, state))
+
+	// ACT: Read twice, write, read again
+	_, err := repo.GetByKey(ctx, accountID, "settings")
+	require.NoError(t, err)
+	cached, err := repo.GetByKey(ctx, accountID, "settings")
+	require.NoError(t, err)
+
+	update := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "settings", State: []byte("v2"), Nonce: []byte("n"), Version: 1}
+	require.NoError(t, repo.Upsert(ctx, update))
+	afterWrite, err := repo.GetByKey(ctx, accountID, "settings")
+	require.NoError(t, err)
+
+	// ASSERT: The second read hit the cache and the write invalidated it
+	assert.Equal(t, []byte("v1"), cached.State)
+	assert.Equal(t, []byte("v2"), afterWrite.State)
+	assert.Equal(t, int64(2), afterWrite.Version)
+
+	stats := repo.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+
+	// Deleted states are not served from the cache either
+	require.NoError(t, repo.Delete(ctx, afterWrite))
+	_, err = repo.GetByKey(ctx, accountID, "settings")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+)
+
+// LeasedEncryptedStateRepository rejects writes to keys under an enforced
+// lease held by another device, and passes everything else through to the
+// wrapped repository. Server-side writes such as expiry reaping are not
+// checked.
+//
+// Leases are advisory and live in Redis, so the check is made just before
+// the write rather than inside its transaction: a lease taken at that very
+// moment may miss one in-flight write. If Redis is unavailable writes go
+// ahead, as they would without leases.
+type LeasedEncryptedStateRepository struct {
+	EncryptedStateRepository
+	leases LeaseRepository
+}
+
+func NewLeasedEncryptedStateRepository(next EncryptedStateRepository, leases LeaseRepository) *LeasedEncryptedStateRepository {
+	return &LeasedEncryptedStateRepository{EncryptedStateRepository: next, leases: leases}
+}
+
+func (r *LeasedEncryptedStateRepository) Upsert(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.Upsert(ctx, state)
+}
+
+func (r *LeasedEncryptedStateRepository) UpsertAs(ctx context.Context, actorID uuid.UUID, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.UpsertAs(ctx, actorID, state)
+}
+
+func (r *LeasedEncryptedStateRepository) UpsertTx(ctx context.Context, tx *Tx, actorID uuid.UUID, state *models.EncryptedState) (string, error) {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return "", err
+	}
+	return r.EncryptedStateRepository.UpsertTx(ctx, tx, actorID, state)
+}
+
+// Delete needs state.AccountID and state.Key set in addition to the ID.
+func (r *LeasedEncryptedStateRepository) Delete(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.Delete(ctx, state)
+}
+
+// DeleteTx needs state.AccountID and state.Key set in addition to the ID.
+func (r *LeasedEncryptedStateRepository) DeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.DeleteTx(ctx, tx, state)
+}
+
+// Undelete needs state.AccountID and state.Key set in addition to the ID.
+func (r *LeasedEncryptedStateRepository) Undelete(ctx context.Context, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.Undelete(ctx, state)
+}
+
+// UndeleteTx needs state.AccountID and state.Key set in addition to the ID.
+func (r *LeasedEncryptedStateRepository) UndeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
+	if err := r.checkLease(ctx, state.AccountID, state.Key, state.DeviceID); err != nil {
+		return err
+	}
+	return r.EncryptedStateRepository.UndeleteTx(ctx, tx, state)
+}
+
+// checkLease returns ErrLeaseHeld if deviceID may not write key.
+func (r *LeasedEncryptedStateRepository) checkLease(ctx context.Context, accountID uuid.UUID, key string, deviceID uuid.UUID) error {
+	lease, err := r.leases.Get(ctx, accountID, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("state leases: failed to check lease on %s: %v", key, err)
+		return nil
+	}
+	if lease.Enforced && lease.DeviceID != deviceID {
+		return leaseHeldError(lease)
+	}
+	return nil
+}
@@ -2,44 +2,71 @@ package repositories
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/blobstore"
 	"github.com/prudhvinik1/edgesync/internal/models"
 )
 
 // ErrVersionConflict is returned when optimistic locking fails
 var ErrVersionConflict = errors.New("version conflict: state was modified by another device")
 
+// ErrKeyRetired is returned when a state is written under a key ID the account has retired
+var ErrKeyRetired = errors.New("encryption key has been retired")
+
+// ErrInvalidVisibility is returned when a state's device scope can't be applied
+var ErrInvalidVisibility = errors.New("invalid state visibility")
+
+// stateColumns is the column list every state query selects, in scanState order.
+const stateColumns = `id, account_id, device_id, key, state, nonce, chunks, visible_to, version, size, content_hash,
+	cipher_suite, key_id, key_generation, format_version, expires_at, created_at, updated_at, deleted_at,
+	COALESCE(blob_key, ''), blob_size`
+
+// liveState matches states that are neither deleted nor expired. Expired
+// states disappear from reads immediately, before the reaper tombstones them.
+const liveState = `deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+
+// visibleTo matches states (or sync events) the device bound to param may
+// read: account-wide ones and those scoped to a list including the device.
+func visibleTo(param string) string {
+	return `(visible_to IS NULL OR ` + param + ` = ANY(visible_to))`
+}
+
 type PostgresEncryptedStateRepository struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	quotas *PostgresQuotaRepository
+
+	blobs            blobstore.BlobStore
+	offloadThreshold int
+}
+
+func NewPostgresEncryptedStateRepository(pool *pgxpool.Pool, quotas *PostgresQuotaRepository) *PostgresEncryptedStateRepository {
+	return &PostgresEncryptedStateRepository{pool: pool, quotas: quotas}
 }
 
-func NewPostgresEncryptedStateRepository(pool *pgxpool.Pool) *PostgresEncryptedStateRepository {
-	return &PostgresEncryptedStateRepository{pool: pool}
+// WithBlobStore moves inline state above threshold bytes out of Postgres into
+// blobs. Reads load it back transparently, so callers always see the full
+// state. States written before (or below the threshold) stay inline.
+func (r *PostgresEncryptedStateRepository) WithBlobStore(blobs blobstore.BlobStore, threshold int) *PostgresEncryptedStateRepository {
+	r.blobs = blobs
+	r.offloadThreshold = threshold
+	return r
 }
 
 func (r *PostgresEncryptedStateRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EncryptedState, error) {
-	query := `SELECT id, account_id, device_id, key, state, nonce, version, created_at, updated_at, deleted_at
+	query := `SELECT ` + stateColumns + `
 	          FROM encrypted_states 
-	          WHERE id = $1 AND deleted_at IS NULL`
+	          WHERE id = $1 AND ` + liveState
 
-	var state models.EncryptedState
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&state.ID,
-		&state.AccountID,
-		&state.DeviceID,
-		&state.Key,
-		&state.State,
-		&state.Nonce,
-		&state.Version,
-		&state.CreatedAt,
-		&state.UpdatedAt,
-		&state.DeletedAt,
-	)
+	state, err := scanState(r.pool.QueryRow(ctx, query, id))
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
@@ -47,13 +74,16 @@ func (r *PostgresEncryptedStateRepository) GetByID(ctx context.Context, id uuid.
 	if err != nil {
 		return nil, fmt.Errorf("failed to get state by ID: %w", err)
 	}
-	return &state, nil
+	if err := r.loadBlob(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
 }
 
 func (r *PostgresEncryptedStateRepository) GetByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.EncryptedState, error) {
-	query := `SELECT id, account_id, device_id, key, state, nonce, version, created_at, updated_at, deleted_at
+	query := `SELECT ` + stateColumns + `
 	          FROM encrypted_states 
-	          WHERE account_id = $1 AND deleted_at IS NULL
+	          WHERE account_id = $1 AND ` + liveState + `
 	          ORDER BY key ASC`
 
 	rows, err := r.pool.Query(ctx, query, accountID)
@@ -64,50 +94,70 @@ func (r *PostgresEncryptedStateRepository) GetByAccountID(ctx context.Context, a
 
 	var states []*models.EncryptedState
 	for rows.Next() {
-		var state models.EncryptedState
-		err := rows.Scan(
-			&state.ID,
-			&state.AccountID,
-			&state.DeviceID,
-			&state.Key,
-			&state.State,
-			&state.Nonce,
-			&state.Version,
-			&state.CreatedAt,
-			&state.UpdatedAt,
-			&state.DeletedAt,
-		)
+		state, err := scanState(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan state: %w", err)
 		}
-		states = append(states, &state)
+		states = append(states, state)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating states: %w", err)
 	}
 
+	if err := r.loadBlobs(ctx, states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// ListByPrefix returns up to limit states visible to deviceID whose key
+// starts with prefix and sorts after the given key, ordered bytewise by key.
+// Pass an empty after to start from the beginning; pass the last key of a
+// page to get the next one.
+func (r *PostgresEncryptedStateRepository) ListByPrefix(ctx context.Context, accountID, deviceID uuid.UUID, prefix, after string, limit int) ([]*models.EncryptedState, error) {
+	query := `SELECT ` + stateColumns + `
+	          FROM encrypted_states
+	          WHERE account_id = $1
+	            AND key COLLATE "C" >= $2
+	            AND starts_with(key, $2)
+	            AND key COLLATE "C" > $3
+	            AND ` + liveState + `
+	            AND ` + visibleTo("$5") + `
+	          ORDER BY key COLLATE "C" ASC
+	          LIMIT $4`
+
+	rows, err := r.pool.Query(ctx, query, accountID, prefix, after, limit, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list states: %w", err)
+	}
+	defer rows.Close()
+
+	var states []*models.EncryptedState
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan state: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating states: %w", err)
+	}
+
+	if err := r.loadBlobs(ctx, states); err != nil {
+		return nil, err
+	}
 	return states, nil
 }
 
 func (r *PostgresEncryptedStateRepository) GetByKey(ctx context.Context, accountID uuid.UUID, key string) (*models.EncryptedState, error) {
-	query := `SELECT id, account_id, device_id, key, state, nonce, version, created_at, updated_at, deleted_at
+	query := `SELECT ` + stateColumns + `
 	          FROM encrypted_states 
-	          WHERE account_id = $1 AND key = $2 AND deleted_at IS NULL`
+	          WHERE account_id = $1 AND key = $2 AND ` + liveState
 
-	var state models.EncryptedState
-	err := r.pool.QueryRow(ctx, query, accountID, key).Scan(
-		&state.ID,
-		&state.AccountID,
-		&state.DeviceID,
-		&state.Key,
-		&state.State,
-		&state.Nonce,
-		&state.Version,
-		&state.CreatedAt,
-		&state.UpdatedAt,
-		&state.DeletedAt,
-	)
+	state, err := scanState(r.pool.QueryRow(ctx, query, accountID, key))
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
@@ -115,41 +165,250 @@ func (r *PostgresEncryptedStateRepository) GetByKey(ctx context.Context, account
 	if err != nil {
 		return nil, fmt.Errorf("failed to get state by key: %w", err)
 	}
-	return &state, nil
+	if err := r.loadBlob(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetByKeyAs returns ownerID's state at key on behalf of actorID, who must be
+// the owner or hold an active share on the state. States the actor can't
+// read are reported as ErrNotFound so shares don't reveal which keys exist.
+// Device-scoped states are never readable by other accounts.
+func (r *PostgresEncryptedStateRepository) GetByKeyAs(ctx context.Context, actorID, ownerID uuid.UUID, key string) (*models.EncryptedState, error) {
+	if actorID == ownerID {
+		return r.GetByKey(ctx, ownerID, key)
+	}
+
+	query := `SELECT ` + stateColumns + `
+	          FROM encrypted_states
+	          WHERE account_id = $1 AND key = $2 AND ` + liveState + ` AND visible_to IS NULL
+	            AND EXISTS (
+	                SELECT 1 FROM state_shares g
+	                WHERE g.state_id = encrypted_states.id AND g.grantee_account_id = $3 AND ` + activeShare + `
+	            )`
+
+	state, err := scanState(r.pool.QueryRow(ctx, query, ownerID, key, actorID))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared state: %w", err)
+	}
+	if err := r.loadBlob(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetManifest returns metadata for every state visible to deviceID whose key
+// starts with prefix (all states when prefix is empty), without reading
+// ciphertext.
+func (r *PostgresEncryptedStateRepository) GetManifest(ctx context.Context, accountID, deviceID uuid.UUID, prefix string) ([]*models.StateManifestEntry, error) {
+	query := `SELECT ` + manifestColumns + `
+	          FROM encrypted_states
+	          WHERE account_id = $1
+	            AND key COLLATE "C" >= $2
+	            AND starts_with(key, $2)
+	            AND ` + liveState + `
+	            AND ` + visibleTo("$3") + `
+	          ORDER BY key COLLATE "C" ASC`
+
+	rows, err := r.pool.Query(ctx, query, accountID, prefix, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query manifest: %w", err)
+	}
+	return collectManifest(rows)
+}
+
+// ListByKeyID returns metadata for every state visible to deviceID still
+// encrypted under the given key ID, so a client rotating keys knows what to
+// re-encrypt.
+func (r *PostgresEncryptedStateRepository) ListByKeyID(ctx context.Context, accountID, deviceID uuid.UUID, keyID string) ([]*models.StateManifestEntry, error) {
+	query := `SELECT ` + manifestColumns + `
+	          FROM encrypted_states
+	          WHERE account_id = $1 AND key_id = $2 AND ` + liveState + ` AND ` + visibleTo("$3") + `
+	          ORDER BY key COLLATE "C" ASC`
+
+	rows, err := r.pool.Query(ctx, query, accountID, keyID, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query states by key ID: %w", err)
+	}
+	return collectManifest(rows)
 }
 
 // Upsert creates or updates an encrypted state with optimistic locking.
 // If the state doesn't exist, it creates it with version 1.
 // If it exists, it only updates if the provided version matches the current version.
+// If the key was deleted or has expired, the old row is replaced and the version
+// sequence continues from it; the expected version must be 0 or the old row's version.
 // On success, the state.Version is incremented and state.ID/timestamps are populated.
+// The write is charged against the account's quota; ErrQuotaExceeded is
+// returned (and nothing is written) if it would go over a limit.
+// No sync event is appended; SyncService writes states together with their
+// events through UpsertTx.
+// state.VisibleTo replaces the state's device scope; its devices must be
+// active devices of the account, and a live scoped state can only be
+// overwritten by one of the devices it is scoped to (ErrAccessDenied).
+// Shared states can't be scoped.
 func (r *PostgresEncryptedStateRepository) Upsert(ctx context.Context, state *models.EncryptedState) error {
-	// First, try to get existing state
-	existing, err := r.GetByKey(ctx, state.AccountID, state.Key)
+	return r.UpsertAs(ctx, state.AccountID, state)
+}
+
+// UpsertAs is Upsert on behalf of actorID. An actor other than the owner
+// (state.AccountID) needs an active read-write share and may only update an
+// existing live state: ErrNotFound is returned without any share and
+// ErrAccessDenied with a read-only one. The owner is charged for the write.
+func (r *PostgresEncryptedStateRepository) UpsertAs(ctx context.Context, actorID uuid.UUID, state *models.EncryptedState) error {
+	return inTx(ctx, r.pool, func(tx *Tx) error {
+		_, err := r.UpsertTx(ctx, tx, actorID, state)
+		return err
+	})
+}
+
+// UpsertTx is UpsertAs within tx. Large state is uploaded to the blob store
+// before any row is locked; the blob is removed again if tx rolls back, and
+// the content it replaces once tx commits. It returns the sync event type
+// (create or update) that announces the write.
+func (r *PostgresEncryptedStateRepository) UpsertTx(ctx context.Context, tx *Tx, actorID uuid.UUID, state *models.EncryptedState) (string, error) {
+	state.BlobKey, state.BlobSize = "", 0
+	if r.blobs != nil && len(state.State) > r.offloadThreshold {
+		blobKey := fmt.Sprintf("states/%s/%s", state.AccountID, uuid.New())
+		if err := r.blobs.Put(ctx, blobKey, state.State); err != nil {
+			return "", fmt.Errorf("failed to store state blob: %w", err)
+		}
+		tx.OnRollback(func() { r.deleteBlob(blobKey) })
+		state.BlobKey, state.BlobSize = blobKey, int64(len(state.State))
+	}
+
+	// First, lock the existing row (live, expired or tombstone) and note its size for accounting
+	var existingID uuid.UUID
+	var existingVersion, existingSize int64
+	var existingBlobKey string
+	var existingVisibleTo []uuid.UUID
+	var deleted, expired bool
+	query := `SELECT id, version, deleted_at IS NOT NULL, COALESCE(expires_at <= NOW(), FALSE),
+	                 octet_length(state) + octet_length(nonce) + blob_size, COALESCE(blob_key, ''), visible_to
+	          FROM encrypted_states
+	          WHERE account_id = $1 AND key = $2
+	          FOR UPDATE`
+	err := tx.QueryRow(ctx, query, state.AccountID, state.Key).Scan(&existingID, &existingVersion, &deleted, &expired,
+		&existingSize, &existingBlobKey, &existingVisibleTo)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to check existing state: %w", err)
+	}
+	exists := err == nil
+
+	if actorID != state.AccountID {
+		if !exists || deleted || expired {
+			return "", ErrNotFound
+		}
+		if err := checkWriteShare(ctx, tx, existingID, actorID); err != nil {
+			return "", err
+		}
+	}
+
+	live := exists && !deleted && !expired
+	if live {
+		existing := models.EncryptedState{VisibleTo: existingVisibleTo}
+		if !existing.VisibleToDevice(state.DeviceID) {
+			return "", fmt.Errorf("%w: state is scoped to other devices", ErrAccessDenied)
+		}
+	}
+	if err := r.checkVisibility(ctx, tx, state, live, existingID); err != nil {
+		return "", err
+	}
+
+	if state.KeyID != "" {
+		var retired bool
+		query = `SELECT EXISTS (SELECT 1 FROM retired_keys WHERE account_id = $1 AND key_id = $2)`
+		if err := tx.QueryRow(ctx, query, state.AccountID, state.KeyID).Scan(&retired); err != nil {
+			return "", fmt.Errorf("failed to check key retirement: %w", err)
+		}
+		if retired {
+			return "", fmt.Errorf("%w: %s", ErrKeyRetired, state.KeyID)
+		}
+	}
+
+	state.ContentHash = contentHash(state)
+	state.Size, err = r.payloadSize(ctx, tx, state)
+	if err != nil {
+		return "", err
+	}
+
+	// The blob limit covers the whole payload, chunks included, so uploading
+	// in chunks doesn't get around it
+	newSize := stateSize(state)
+	delta := usageDelta{Bytes: newSize, BlobSize: state.Size - int64(len(state.Nonce))}
 
-	if errors.Is(err, ErrNotFound) {
+	eventType := models.EventTypeCreate
+	switch {
+	case !exists:
 		// State doesn't exist - INSERT new state
-		return r.create(ctx, state)
+		err = r.create(ctx, tx, state)
+		delta.Keys = 1
+	case deleted:
+		// Tombstone - recreate the key, continuing its version sequence
+		if state.Version != 0 && state.Version != existingVersion {
+			return "", ErrVersionConflict
+		}
+		err = r.revive(ctx, tx, state, existingID)
+		delta.Keys = 1
+	case expired:
+		// Expired but not reaped yet - readers already see it as gone, and
+		// its usage has not been released, so only the size changes
+		if state.Version != 0 && state.Version != existingVersion {
+			return "", ErrVersionConflict
+		}
+		err = r.revive(ctx, tx, state, existingID)
+		delta.Bytes = newSize - existingSize
+	default:
+		// State exists - UPDATE with optimistic locking
+		err = r.update(ctx, tx, state, existingID)
+		delta.Bytes = newSize - existingSize
+		eventType = models.EventTypeUpdate
 	}
 	if err != nil {
-		return fmt.Errorf("failed to check existing state: %w", err)
+		return "", err
 	}
 
-	// State exists - UPDATE with optimistic locking
-	return r.update(ctx, state, existing.ID)
+	if err := r.quotas.charge(ctx, tx, state.AccountID, delta); err != nil {
+		return "", err
+	}
+
+	// The previous content, if offloaded, is no longer referenced
+	if existingBlobKey != "" {
+		tx.OnCommit(func() { r.deleteBlob(existingBlobKey) })
+	}
+	return eventType, nil
 }
 
 // create inserts a new encrypted state
-func (r *PostgresEncryptedStateRepository) create(ctx context.Context, state *models.EncryptedState) error {
-	query := `INSERT INTO encrypted_states (account_id, device_id, key, state, nonce, version)
-	          VALUES ($1, $2, $3, $4, $5, 1)
+func (r *PostgresEncryptedStateRepository) create(ctx context.Context, db DBTX, state *models.EncryptedState) error {
+	query := `INSERT INTO encrypted_states (account_id, device_id, key, state, nonce, chunks, size, content_hash,
+	                                        cipher_suite, key_id, key_generation, format_version, expires_at,
+	                                        blob_key, blob_size, visible_to, version)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, $16, 1)
 	          RETURNING id, version, created_at, updated_at`
 
-	err := r.pool.QueryRow(ctx, query,
+	err := db.QueryRow(ctx, query,
 		state.AccountID,
 		state.DeviceID,
 		state.Key,
-		state.State,
+		inlineState(state),
 		state.Nonce,
+		state.Chunks,
+		state.Size,
+		state.ContentHash,
+		state.CipherSuite,
+		state.KeyID,
+		state.KeyGeneration,
+		state.FormatVersion,
+		state.ExpiresAt,
+		state.BlobKey,
+		state.BlobSize,
+		state.VisibleTo,
 	).Scan(&state.ID, &state.Version, &state.CreatedAt, &state.UpdatedAt)
 
 	if err != nil {
@@ -159,25 +418,47 @@ func (r *PostgresEncryptedStateRepository) create(ctx context.Context, state *mo
 }
 
 // update updates an existing encrypted state with optimistic locking
-func (r *PostgresEncryptedStateRepository) update(ctx context.Context, state *models.EncryptedState, existingID uuid.UUID) error {
+func (r *PostgresEncryptedStateRepository) update(ctx context.Context, db DBTX, state *models.EncryptedState, existingID uuid.UUID) error {
 	// CRITICAL: The WHERE clause includes version check for optimistic locking
 	// Only updates if the current version matches what the client expects
 	query := `UPDATE encrypted_states 
 	          SET device_id = $1, 
 	              state = $2, 
 	              nonce = $3, 
+	              chunks = $4,
+	              size = $5,
+	              content_hash = $6,
+	              cipher_suite = $7,
+	              key_id = $8,
+	              key_generation = $9,
+	              format_version = $10,
+	              expires_at = $11,
+	              blob_key = NULLIF($14, ''),
+	              blob_size = $15,
+	              visible_to = $16,
 	              version = version + 1, 
 	              updated_at = NOW()
-	          WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+	          WHERE id = $12 AND version = $13 AND deleted_at IS NULL
 	          RETURNING version, updated_at`
 
 	var newVersion int64
-	err := r.pool.QueryRow(ctx, query,
+	err := db.QueryRow(ctx, query,
 		state.DeviceID,
-		state.State,
+		inlineState(state),
 		state.Nonce,
+		state.Chunks,
+		state.Size,
+		state.ContentHash,
+		state.CipherSuite,
+		state.KeyID,
+		state.KeyGeneration,
+		state.FormatVersion,
+		state.ExpiresAt,
 		existingID,
 		state.Version, // Expected version - must match!
+		state.BlobKey,
+		state.BlobSize,
+		state.VisibleTo,
 	).Scan(&newVersion, &state.UpdatedAt)
 
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -194,18 +475,477 @@ func (r *PostgresEncryptedStateRepository) update(ctx context.Context, state *mo
 	return nil
 }
 
-func (r *PostgresEncryptedStateRepository) Delete(ctx context.Context, id uuid.UUID) error {
+// revive overwrites a tombstone or expired state with new content. The caller
+// holds the row lock and has checked the expected version.
+func (r *PostgresEncryptedStateRepository) revive(ctx context.Context, db DBTX, state *models.EncryptedState, existingID uuid.UUID) error {
+	query := `UPDATE encrypted_states
+	          SET device_id = $1,
+	              state = $2,
+	              nonce = $3,
+	              chunks = $4,
+	              size = $5,
+	              content_hash = $6,
+	              cipher_suite = $7,
+	              key_id = $8,
+	              key_generation = $9,
+	              format_version = $10,
+	              expires_at = $11,
+	              blob_key = NULLIF($13, ''),
+	              blob_size = $14,
+	              visible_to = $15,
+	              version = version + 1,
+	              updated_at = NOW(),
+	              deleted_at = NULL,
+	              purged_at = NULL
+	          WHERE id = $12
+	          RETURNING version, created_at, updated_at`
+
+	err := db.QueryRow(ctx, query,
+		state.DeviceID,
+		inlineState(state),
+		state.Nonce,
+		state.Chunks,
+		state.Size,
+		state.ContentHash,
+		state.CipherSuite,
+		state.KeyID,
+		state.KeyGeneration,
+		state.FormatVersion,
+		state.ExpiresAt,
+		existingID,
+		state.BlobKey,
+		state.BlobSize,
+		state.VisibleTo,
+	).Scan(&state.Version, &state.CreatedAt, &state.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to recreate state: %w", err)
+	}
+	state.ID = existingID
+	state.DeletedAt = nil
+	return nil
+}
+
+// Delete turns a state into a tombstone, provided state.Version matches the
+// current version (ErrVersionConflict otherwise). The tombstone takes the next
+// version number and keeps its content until purged, so it can be undeleted.
+// On success state.Version and state.DeletedAt are updated and the state's
+// usage is released.
+func (r *PostgresEncryptedStateRepository) Delete(ctx context.Context, state *models.EncryptedState) error {
+	return inTx(ctx, r.pool, func(tx *Tx) error {
+		return r.DeleteTx(ctx, tx, state)
+	})
+}
+
+// DeleteTx is Delete within tx.
+func (r *PostgresEncryptedStateRepository) DeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
 	query := `UPDATE encrypted_states 
-	          SET deleted_at = NOW() 
-	          WHERE id = $1 AND deleted_at IS NULL`
+	          SET deleted_at = NOW(),
+	              device_id = $3,
+	              version = version + 1,
+	              updated_at = NOW()
+	          WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	          RETURNING account_id, key, version, deleted_at, visible_to, octet_length(state) + octet_length(nonce) + blob_size`
 
-	result, err := r.pool.Exec(ctx, query, id)
+	var size int64
+	err := tx.QueryRow(ctx, query, state.ID, state.Version, state.DeviceID).Scan(
+		&state.AccountID,
+		&state.Key,
+		&state.Version,
+		&state.DeletedAt,
+		&state.VisibleTo,
+		&size,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.missingOrConflict(ctx, tx, state.ID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete state: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
+	return r.quotas.charge(ctx, tx, state.AccountID, usageDelta{Bytes: -size, Keys: -1})
+}
+
+// GetTombstone returns a deleted state whose content has not been purged yet.
+func (r *PostgresEncryptedStateRepository) GetTombstone(ctx context.Context, accountID uuid.UUID, key string) (*models.EncryptedState, error) {
+	query := `SELECT ` + stateColumns + `
+	          FROM encrypted_states
+	          WHERE account_id = $1 AND key = $2 AND deleted_at IS NOT NULL AND purged_at IS NULL`
+
+	state, err := scanState(r.pool.QueryRow(ctx, query, accountID, key))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tombstone: %w", err)
+	}
+	if err := r.loadBlob(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Undelete restores a tombstone's last content as a new version, provided
+// state.Version matches the tombstone's version. state.ID and state.DeviceID
+// identify the tombstone and the restoring device; on success state is
+// replaced with the restored state. The content is charged against the quota
+// again. Any expiry is cleared, so an expired state can be brought back.
+func (r *PostgresEncryptedStateRepository) Undelete(ctx context.Context, state *models.EncryptedState) error {
+	return inTx(ctx, r.pool, func(tx *Tx) error {
+		return r.UndeleteTx(ctx, tx, state)
+	})
+}
+
+// UndeleteTx is Undelete within tx.
+func (r *PostgresEncryptedStateRepository) UndeleteTx(ctx context.Context, tx *Tx, state *models.EncryptedState) error {
+	query := `UPDATE encrypted_states
+	          SET deleted_at = NULL,
+	              expires_at = NULL,
+	              device_id = $3,
+	              version = version + 1,
+	              updated_at = NOW()
+	          WHERE id = $1 AND version = $2 AND deleted_at IS NOT NULL AND purged_at IS NULL
+	          RETURNING ` + stateColumns
+
+	restored, err := scanState(tx.QueryRow(ctx, query, state.ID, state.Version, state.DeviceID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.missingOrConflict(ctx, tx, state.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to undelete state: %w", err)
+	}
+	if err := r.loadBlob(ctx, restored); err != nil {
+		return err
+	}
+
+	delta := usageDelta{Bytes: stateSize(restored), Keys: 1}
+	if err := r.quotas.charge(ctx, tx, restored.AccountID, delta); err != nil {
+		return err
+	}
+
+	*state = *restored
+	return nil
+}
+
+// PurgeTombstones drops the content of states deleted before the cutoff,
+// keeping the tombstone row (and its version) so the key's version sequence
+// continues if it is recreated. Purged tombstones can no longer be undeleted
+// and their chunks become eligible for garbage collection. Offloaded content
+// is removed from the blob store once the purge has committed.
+func (r *PostgresEncryptedStateRepository) PurgeTombstones(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `WITH purged AS (
+	              SELECT id, blob_key FROM encrypted_states
+	              WHERE deleted_at < $1 AND purged_at IS NULL
+	              FOR UPDATE
+	          )
+	          UPDATE encrypted_states s
+	          SET state = '', nonce = '', chunks = NULL, size = 0, blob_key = NULL, blob_size = 0, purged_at = NOW()
+	          FROM purged p
+	          WHERE s.id = p.id
+	          RETURNING COALESCE(p.blob_key, '')`
+
+	rows, err := r.pool.Query(ctx, query, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tombstones: %w", err)
+	}
+	blobKeys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tombstones: %w", err)
+	}
+
+	for _, blobKey := range blobKeys {
+		if blobKey != "" {
+			r.deleteBlob(blobKey)
+		}
+	}
+	return int64(len(blobKeys)), nil
+}
+
+// ExpiredAccountIDs returns up to limit accounts that have states whose
+// expiry has passed.
+func (r *PostgresEncryptedStateRepository) ExpiredAccountIDs(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	query := `SELECT DISTINCT account_id FROM encrypted_states
+	          WHERE expires_at <= NOW() AND deleted_at IS NULL
+	          LIMIT $1`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts with expired states: %w", err)
+	}
+	accountIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts with expired states: %w", err)
+	}
+	return accountIDs, nil
+}
+
+// ReapExpired tombstones up to limit of the account's states whose expiry
+// has passed, in one transaction. Reaped states release their usage like a
+// normal delete. It returns the tombstones.
+func (r *PostgresEncryptedStateRepository) ReapExpired(ctx context.Context, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error) {
+	var reaped []*models.EncryptedState
+	err := inTx(ctx, r.pool, func(tx *Tx) error {
+		var err error
+		reaped, err = r.ReapExpiredTx(ctx, tx, accountID, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reaped, nil
+}
+
+// ReapExpiredTx is ReapExpired within tx. Reaping one account at a time
+// keeps the transaction to that account's usage and event counters, taken
+// in the same order as any other write.
+func (r *PostgresEncryptedStateRepository) ReapExpiredTx(ctx context.Context, tx *Tx, accountID uuid.UUID, limit int) ([]*models.EncryptedState, error) {
+	// SKIP LOCKED lets several server instances reap concurrently
+	query := `UPDATE encrypted_states
+	          SET deleted_at = NOW(),
+	              version = version + 1,
+	              updated_at = NOW()
+	          WHERE id IN (
+	              SELECT id FROM encrypted_states
+	              WHERE account_id = $1 AND expires_at <= NOW() AND deleted_at IS NULL
+	              ORDER BY expires_at
+	              LIMIT $2
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING ` + stateColumns
+
+	rows, err := tx.Query(ctx, query, accountID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reap expired states: %w", err)
+	}
+
+	var reaped []*models.EncryptedState
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan reaped state: %w", err)
+		}
+		reaped = append(reaped, state)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reaped states: %w", err)
+	}
+
+	for _, state := range reaped {
+		delta := usageDelta{Bytes: -stateSize(state), Keys: -1}
+		if err := r.quotas.charge(ctx, tx, state.AccountID, delta); err != nil {
+			return nil, err
+		}
+	}
+	return reaped, nil
+}
+
+// checkVisibility validates the device scope of a state being written: every
+// listed device must be an active device of the account, and a state with
+// active shares can't be scoped, since grantees could no longer read it.
+func (r *PostgresEncryptedStateRepository) checkVisibility(ctx context.Context, db DBTX, state *models.EncryptedState, live bool, existingID uuid.UUID) error {
+	if state.VisibleTo == nil {
+		return nil
+	}
+
+	var allActive bool
+	query := `SELECT (SELECT COUNT(*) FROM devices
+	                  WHERE account_id = $1 AND id = ANY($2) AND revoked_at IS NULL AND deleted_at IS NULL)
+	               = (SELECT COUNT(DISTINCT d) FROM unnest($2::uuid[]) AS d)`
+	if err := db.QueryRow(ctx, query, state.AccountID, state.VisibleTo).Scan(&allActive); err != nil {
+		return fmt.Errorf("failed to check visible devices: %w", err)
+	}
+	if !allActive {
+		return fmt.Errorf("%w: unknown or revoked device", ErrInvalidVisibility)
+	}
+
+	if live {
+		var shared bool
+		query = `SELECT EXISTS (SELECT 1 FROM state_shares g WHERE g.state_id = $1 AND ` + activeShare + `)`
+		if err := db.QueryRow(ctx, query, existingID).Scan(&shared); err != nil {
+			return fmt.Errorf("failed to check shares: %w", err)
+		}
+		if shared {
+			return fmt.Errorf("%w: shared states can't be scoped to devices", ErrInvalidVisibility)
+		}
+	}
+	return nil
+}
+
+// missingOrConflict explains why a versioned write by ID matched no row:
+// ErrNotFound if the row does not exist, ErrVersionConflict otherwise.
+func (r *PostgresEncryptedStateRepository) missingOrConflict(ctx context.Context, db DBTX, id uuid.UUID) error {
+	var exists bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM encrypted_states WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check state: %w", err)
+	}
+	if !exists {
 		return ErrNotFound
 	}
+	return ErrVersionConflict
+}
+
+// payloadSize is the logical ciphertext size reported in manifests: the inline
+// state plus nonce, plus the size of every referenced chunk.
+func (r *PostgresEncryptedStateRepository) payloadSize(ctx context.Context, db DBTX, state *models.EncryptedState) (int64, error) {
+	size := int64(len(state.State) + len(state.Nonce))
+	if len(state.Chunks) == 0 {
+		return size, nil
+	}
+
+	// unnest keeps duplicates, so a chunk listed twice is counted twice
+	query := `SELECT COALESCE(SUM(c.size), 0)
+	          FROM unnest($2::text[]) AS h(hash)
+	          JOIN chunks c ON c.account_id = $1 AND c.hash = h.hash`
+
+	var chunkBytes int64
+	if err := db.QueryRow(ctx, query, state.AccountID, state.Chunks).Scan(&chunkBytes); err != nil {
+		return 0, fmt.Errorf("failed to size chunks: %w", err)
+	}
+	return size + chunkBytes, nil
+}
+
+// contentHash fingerprints a state's ciphertext: the hex SHA-256 of
+// state || nonce, followed by the chunk hashes in order for chunked states.
+func contentHash(state *models.EncryptedState) string {
+	h := sha256.New()
+	h.Write(state.State)
+	h.Write(state.Nonce)
+	for _, chunk := range state.Chunks {
+		h.Write([]byte(chunk))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stateSize is the number of bytes a state counts against the storage quota.
+// Chunk payloads are charged separately when the chunks are uploaded.
+// Offloaded state counts the same as inline state, loaded or not.
+func stateSize(state *models.EncryptedState) int64 {
+	if state.BlobKey != "" {
+		return state.BlobSize + int64(len(state.Nonce))
+	}
+	return int64(len(state.State) + len(state.Nonce))
+}
+
+// inlineState is the value stored in the state column: empty when the state
+// has been offloaded to the blob store.
+func inlineState(state *models.EncryptedState) []byte {
+	if state.BlobKey != "" {
+		return []byte{}
+	}
+	return state.State
+}
+
+// loadBlob fills in state.State for a state whose content was offloaded.
+func (r *PostgresEncryptedStateRepository) loadBlob(ctx context.Context, state *models.EncryptedState) error {
+	return loadStateBlob(ctx, r.blobs, state)
+}
+
+func loadStateBlob(ctx context.Context, blobs blobstore.BlobStore, state *models.EncryptedState) error {
+	if state.BlobKey == "" {
+		return nil
+	}
+	if blobs == nil {
+		return fmt.Errorf("state %s is offloaded but no blob store is configured", state.ID)
+	}
+	data, err := blobs.Get(ctx, state.BlobKey)
+	if err != nil {
+		return fmt.Errorf("failed to load state blob: %w", err)
+	}
+	state.State = data
+	return nil
+}
+
+func (r *PostgresEncryptedStateRepository) loadBlobs(ctx context.Context, states []*models.EncryptedState) error {
+	for _, state := range states {
+		if err := r.loadBlob(ctx, state); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// deleteBlob removes a blob that is no longer referenced. Failures only leave
+// an orphaned blob behind, so they are logged rather than returned.
+func (r *PostgresEncryptedStateRepository) deleteBlob(blobKey string) {
+	if r.blobs == nil {
+		log.Printf("cannot delete state blob %s: no blob store is configured", blobKey)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := r.blobs.Delete(ctx, blobKey); err != nil {
+		log.Printf("failed to delete state blob %s: %v", blobKey, err)
+	}
+}
+
+// manifestColumns is the column list manifest queries select, in collectManifest order.
+const manifestColumns = `key, version, size, content_hash, COALESCE(updated_at, created_at), device_id,
+	cipher_suite, key_id, key_generation, format_version`
+
+func collectManifest(rows pgx.Rows) ([]*models.StateManifestEntry, error) {
+	defer rows.Close()
+
+	entries := []*models.StateManifestEntry{}
+	for rows.Next() {
+		var entry models.StateManifestEntry
+		err := rows.Scan(
+			&entry.Key,
+			&entry.Version,
+			&entry.Size,
+			&entry.ContentHash,
+			&entry.UpdatedAt,
+			&entry.DeviceID,
+			&entry.CipherSuite,
+			&entry.KeyID,
+			&entry.KeyGeneration,
+			&entry.FormatVersion,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan manifest entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating manifest: %w", err)
+	}
+
+	return entries, nil
+}
+
+// scanState reads one row selected with stateColumns. Offloaded state comes
+// back empty; the repository loads it with loadBlob.
+func scanState(row pgx.Row) (*models.EncryptedState, error) {
+	var state models.EncryptedState
+	err := row.Scan(
+		&state.ID,
+		&state.AccountID,
+		&state.DeviceID,
+		&state.Key,
+		&state.State,
+		&state.Nonce,
+		&state.Chunks,
+		&state.VisibleTo,
+		&state.Version,
+		&state.Size,
+		&state.ContentHash,
+		&state.CipherSuite,
+		&state.KeyID,
+		&state.KeyGeneration,
+		&state.FormatVersion,
+		&state.ExpiresAt,
+		&state.CreatedAt,
+		&state.UpdatedAt,
+		&state.DeletedAt,
+		&state.BlobKey,
+		&state.BlobSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -3,9 +3,11 @@ package repositories
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prudhvinik1/edgesync/internal/blobstore"
 	"github.com/prudhvinik1/edgesync/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,7 +17,7 @@ import (
 func TestStateRepository_Upsert_Create(t *testing.T) {
 	// ARRANGE: Setup test database connection
 	pool := getTestPool(t)
-	repo := NewPostgresEncryptedStateRepository(pool)
+	repo := newTestStateRepo(pool)
 	accountRepo := NewPostgresAccountRepository(pool)
 	deviceRepo := NewPostgresDeviceRepository(pool)
 	ctx := context.Background()
@@ -46,7 +48,7 @@ func TestStateRepository_Upsert_Create(t *testing.T) {
 // TestStateRepository_Upsert_Update tests updating an existing state successfully
 func TestStateRepository_Upsert_Update(t *testing.T) {
 	pool := getTestPool(t)
-	repo := NewPostgresEncryptedStateRepository(pool)
+	repo := newTestStateRepo(pool)
 	accountRepo := NewPostgresAccountRepository(pool)
 	deviceRepo := NewPostgresDeviceRepository(pool)
 	ctx := context.Background()
@@ -90,7 +92,7 @@ func TestStateRepository_Upsert_Update(t *testing.T) {
 // This is the CRITICAL test - ensures conflicts are detected!
 func TestStateRepository_Upsert_VersionConflict(t *testing.T) {
 	pool := getTestPool(t)
-	repo := NewPostgresEncryptedStateRepository(pool)
+	repo := newTestStateRepo(pool)
 	accountRepo := NewPostgresAccountRepository(pool)
 	deviceRepo := NewPostgresDeviceRepository(pool)
 	ctx := context.Background()
@@ -154,7 +156,7 @@ func TestStateRepository_Upsert_VersionConflict(t *testing.T) {
 // TestStateRepository_GetByKey tests retrieving state by account + key
 func TestStateRepository_GetByKey(t *testing.T) {
 	pool := getTestPool(t)
-	repo := NewPostgresEncryptedStateRepository(pool)
+	repo := newTestStateRepo(pool)
 	accountRepo := NewPostgresAccountRepository(pool)
 	deviceRepo := NewPostgresDeviceRepository(pool)
 	ctx := context.Background()
@@ -185,6 +187,321 @@ func TestStateRepository_GetByKey(t *testing.T) {
 	assert.Equal(t, []byte("encrypted-data"), retrieved.State)
 }
 
+// TestStateRepository_ListByPrefix tests prefix filtering and keyset pagination
+func TestStateRepository_ListByPrefix(t *testing.T) {
+	pool := getTestPool(t)
+	repo := newTestStateRepo(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	for _, key := range []string{"notes/2026/b", "notes/2026/a", "notes/2025/z", "photos/1", "notesx"} {
+		state := &models.EncryptedState{
+			AccountID: accountID,
+			DeviceID:  deviceID,
+			Key:       key,
+			State:     []byte("data"),
+			Nonce:     []byte("nonce"),
+		}
+		require.NoError(t, repo.Upsert(ctx, state))
+	}
+
+	// ACT: Page through "notes/" two keys at a time
+	first, err := repo.ListByPrefix(ctx, accountID, deviceID, "notes/", "", 2)
+	require.NoError(t, err)
+	second, err := repo.ListByPrefix(ctx, accountID, deviceID, "notes/", first[len(first)-1].Key, 2)
+	require.NoError(t, err)
+
+	// ASSERT: Keys come back in order, only under the prefix
+	require.Len(t, first, 2)
+	assert.Equal(t, "notes/2025/z", first[0].Key)
+	assert.Equal(t, "notes/2026/a", first[1].Key)
+	require.Len(t, second, 1, "notesx and photos/1 are outside the prefix")
+	assert.Equal(t, "notes/2026/b", second[0].Key)
+}
+
+// TestStateRepository_GetManifest tests that the manifest carries metadata matching the stored state
+func TestStateRepository_GetManifest(t *testing.T) {
+	pool := getTestPool(t)
+	repo := newTestStateRepo(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	state := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Key:       "notes/today",
+		State:     []byte("encrypted-data"),
+		Nonce:     []byte("nonce"),
+	}
+	require.NoError(t, repo.Upsert(ctx, state))
+	other := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Key:       "settings",
+		State:     []byte("other"),
+		Nonce:     []byte("nonce"),
+	}
+	require.NoError(t, repo.Upsert(ctx, other))
+
+	// ACT: Get the manifest for "notes/"
+	entries, err := repo.GetManifest(ctx, accountID, deviceID, "notes/")
+
+	// ASSERT: Only the matching key, with the metadata from the write
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "notes/today", entries[0].Key)
+	assert.Equal(t, int64(1), entries[0].Version)
+	assert.Equal(t, int64(19), entries[0].Size)
+	assert.Equal(t, state.ContentHash, entries[0].ContentHash)
+	assert.Len(t, entries[0].ContentHash, 64)
+	assert.Equal(t, deviceID, entries[0].DeviceID)
+}
+
+// TestStateRepository_Delete_VersionConflict tests that a delete with a stale version is rejected
+func TestStateRepository_Delete_VersionConflict(t *testing.T) {
+	pool := getTestPool(t)
+	repo := newTestStateRepo(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	state := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "doc", State: []byte("v1"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, state))
+	require.NoError(t, repo.Upsert(ctx, state)) // now version 2
+
+	// ACT: Delete with the stale version 1
+	stale := &models.EncryptedState{ID: state.ID, DeviceID: deviceID, Version: 1}
+	err := repo.Delete(ctx, stale)
+
+	// ASSERT: Conflict, and the state is still there
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = repo.GetByKey(ctx, accountID, "doc")
+	assert.NoError(t, err)
+}
+
+// TestStateRepository_Tombstone_RecreateAndUndelete tests that versions continue across delete, recreate and undelete
+func TestStateRepository_Tombstone_RecreateAndUndelete(t *testing.T) {
+	pool := getTestPool(t)
+	repo := newTestStateRepo(pool)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	state := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "doc", State: []byte("original"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, state))
+
+	// Delete version 1 -> tombstone at version 2
+	require.NoError(t, repo.Delete(ctx, state))
+	assert.Equal(t, int64(2), state.Version)
+	assert.NotNil(t, state.DeletedAt)
+
+	_, err := repo.GetByKey(ctx, accountID, "doc")
+	assert.ErrorIs(t, err, ErrNotFound, "Deleted state should be hidden")
+
+	// Undelete the tombstone -> version 3 with the original content
+	tombstone, err := repo.GetTombstone(ctx, accountID, "doc")
+	require.NoError(t, err)
+	tombstone.DeviceID = deviceID
+	require.NoError(t, repo.Undelete(ctx, tombstone))
+	assert.Equal(t, int64(3), tombstone.Version)
+	assert.Equal(t, []byte("original"), tombstone.State)
+
+	// Delete again -> version 4, then recreate with version 0 -> version 5
+	require.NoError(t, repo.Delete(ctx, tombstone))
+	recreated := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "doc", State: []byte("new"), Nonce: []byte("n")}
+	err = repo.Upsert(ctx, recreated)
+
+	// ASSERT: The key was recreated in place and its versions kept counting up
+	require.NoError(t, err)
+	assert.Equal(t, state.ID, recreated.ID)
+	assert.Equal(t, int64(5), recreated.Version)
+}
+
+// TestStateRepository_ReapExpired tests that expired states are hidden and then tombstoned
+func TestStateRepository_ReapExpired(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	expiresAt := time.Now().Add(-time.Second)
+	state := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Key:       "handoff",
+		State:     []byte("payload"),
+		Nonce:     []byte("nonce"),
+		ExpiresAt: &expiresAt,
+	}
+	require.NoError(t, repo.Upsert(ctx, state))
+
+	_, err := repo.GetByKey(ctx, accountID, "handoff")
+	assert.ErrorIs(t, err, ErrNotFound, "Expired state should be hidden before reaping")
+
+	// ACT: Reap
+	reaped, err := repo.ReapExpired(ctx, accountID, 1000)
+
+	// ASSERT: Our state was tombstoned at the next version and released its usage
+	require.NoError(t, err)
+	var ours *models.EncryptedState
+	for _, r := range reaped {
+		if r.ID == state.ID {
+			ours = r
+		}
+	}
+	require.NotNil(t, ours, "State should have been reaped")
+	assert.Equal(t, int64(2), ours.Version)
+	assert.NotNil(t, ours.DeletedAt)
+
+	usage, err := quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.KeyCount)
+}
+
+// TestStateRepository_OffloadsLargeState tests that large state moves to the blob store transparently
+func TestStateRepository_OffloadsLargeState(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	blobs, err := blobstore.NewFilesystemStore(t.TempDir())
+	require.NoError(t, err)
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo).WithBlobStore(blobs, 8)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	small := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "small", State: []byte("tiny"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, small))
+
+	// ACT: Write a state above the threshold
+	large := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "large", State: []byte("larger than eight bytes"), Nonce: []byte("n")}
+	err = repo.Upsert(ctx, large)
+
+	// ASSERT: Postgres keeps an empty state and a blob reference
+	require.NoError(t, err)
+	var inline []byte
+	var blobKey *string
+	err = pool.QueryRow(ctx, `SELECT state, blob_key FROM encrypted_states WHERE id = $1`, large.ID).Scan(&inline, &blobKey)
+	require.NoError(t, err)
+	assert.Empty(t, inline)
+	require.NotNil(t, blobKey)
+	firstBlob := *blobKey
+
+	err = pool.QueryRow(ctx, `SELECT state, blob_key FROM encrypted_states WHERE id = $1`, small.ID).Scan(&inline, &blobKey)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiny"), inline, "Small state should stay inline")
+	assert.Nil(t, blobKey)
+
+	// Reads return the full state and usage counts the offloaded bytes
+	retrieved, err := repo.GetByKey(ctx, accountID, "large")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("larger than eight bytes"), retrieved.State)
+	assert.Equal(t, large.ContentHash, retrieved.ContentHash)
+
+	usage, err := quotaRepo.GetUsage(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("tiny")+len("n")+len("larger than eight bytes")+len("n")), usage.BytesUsed)
+
+	// Overwriting releases the previous blob
+	large.State = []byte("replaced by another big value")
+	require.NoError(t, repo.Upsert(ctx, large))
+	_, err = blobs.Get(ctx, firstBlob)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound, "Previous blob should be deleted")
+
+	retrieved, err = repo.GetByKey(ctx, accountID, "large")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced by another big value"), retrieved.State)
+}
+
+// TestStateRepository_DeviceScopedStates tests that scoped states are hidden from other devices
+func TestStateRepository_DeviceScopedStates(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	repo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, laptopID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	phone := &models.Device{AccountID: accountID, Name: "Phone", DeviceType: "mobile"}
+	require.NoError(t, deviceRepo.Create(ctx, phone))
+
+	shared := &models.EncryptedState{AccountID: accountID, DeviceID: laptopID, Key: "cache/shared", State: []byte("a"), Nonce: []byte("n")}
+	require.NoError(t, repo.Upsert(ctx, shared))
+
+	// ACT: The laptop stores a state only it may read
+	private := &models.EncryptedState{
+		AccountID: accountID,
+		DeviceID:  laptopID,
+		Key:       "cache/laptop",
+		State:     []byte("b"),
+		Nonce:     []byte("n"),
+		VisibleTo: []uuid.UUID{laptopID},
+	}
+	err := repo.Upsert(ctx, private)
+
+	// ASSERT: Listings for the phone leave it out
+	require.NoError(t, err)
+
+	laptopStates, err := repo.ListByPrefix(ctx, accountID, laptopID, "cache/", "", 10)
+	require.NoError(t, err)
+	assert.Len(t, laptopStates, 2)
+
+	phoneStates, err := repo.ListByPrefix(ctx, accountID, phone.ID, "cache/", "", 10)
+	require.NoError(t, err)
+	require.Len(t, phoneStates, 1)
+	assert.Equal(t, "cache/shared", phoneStates[0].Key)
+
+	manifest, err := repo.GetManifest(ctx, accountID, phone.ID, "cache/")
+	require.NoError(t, err)
+	assert.Len(t, manifest, 1)
+
+	// The phone can't overwrite it
+	err = repo.Upsert(ctx, &models.EncryptedState{AccountID: accountID, DeviceID: phone.ID, Key: "cache/laptop", State: []byte("c"), Nonce: []byte("n"), Version: 1})
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	// Scopes must name the account's own active devices
+	err = repo.Upsert(ctx, &models.EncryptedState{AccountID: accountID, DeviceID: laptopID, Key: "cache/other", State: []byte("d"), Nonce: []byte("n"), VisibleTo: []uuid.UUID{uuid.New()}})
+	assert.ErrorIs(t, err, ErrInvalidVisibility)
+
+	// Events about scoped states only reach the scoped devices
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: laptopID, EventType: models.EventTypeUpdate, StateKey: "cache/laptop", StateVersion: 1, VisibleTo: []uuid.UUID{laptopID}}))
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: laptopID, EventType: models.EventTypeUpdate, StateKey: "cache/shared", StateVersion: 1}))
+
+	laptopEvents, err := eventRepo.GetSinceSequence(ctx, accountID, laptopID, 0, models.EventFilter{}, 100)
+	require.NoError(t, err)
+	assert.Len(t, laptopEvents, 2)
+
+	phoneEvents, err := eventRepo.GetSinceSequence(ctx, accountID, phone.ID, 0, models.EventFilter{}, 100)
+	require.NoError(t, err)
+	require.Len(t, phoneEvents, 1)
+	assert.Equal(t, "cache/shared", phoneEvents[0].StateKey)
+}
+
 // Helper functions for test setup
 
 // getTestPool returns a connection pool for testing
@@ -197,6 +514,12 @@ func getTestPool(t *testing.T) *pgxpool.Pool {
 	return pool
 }
 
+// newTestStateRepo returns a state repository whose quota repository has no
+// limits, for tests that don't look at usage
+func newTestStateRepo(pool *pgxpool.Pool) *PostgresEncryptedStateRepository {
+	return NewPostgresEncryptedStateRepository(pool, NewPostgresQuotaRepository(pool, models.QuotaLimits{}))
+}
+
 // setupTestAccountAndDevice creates a test account and device for foreign key constraints
 func setupTestAccountAndDevice(t *testing.T, ctx context.Context, pool *pgxpool.Pool, accountRepo *PostgresAccountRepository, deviceRepo *PostgresDeviceRepository) (uuid.UUID, uuid.UUID) {
 	// Create test account
@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// partitionLockKey serializes partition maintenance across server instances.
+const partitionLockKey = `SELECT pg_advisory_xact_lock(hashtext('sync_events_partitions'))`
+
+// eventPartition is one partition of sync_events and the exclusive upper
+// bound of the created_at range it holds.
+type eventPartition struct {
+	name  string
+	upper time.Time
+}
+
+// EnsurePartitions creates the monthly (UTC) partitions of sync_events
+// needed to hold events from now until months ahead, skipping months an
+// existing partition already covers. Inserts fail for a month without a
+// partition, so this must run well before each month starts.
+func (r *PostgresSyncEventRepository) EnsurePartitions(ctx context.Context, now time.Time, months int) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, partitionLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock partitions: %w", err)
+	}
+
+	partitions, err := listEventPartitions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, months+1, 0)
+	if n := len(partitions); n > 0 && partitions[n-1].upper.After(start) {
+		start = partitions[n-1].upper.UTC()
+	}
+
+	created := 0
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		name := pgx.Identifier{"sync_events_p" + month.Format("200601")}.Sanitize()
+		query := fmt.Sprintf(`CREATE TABLE %s PARTITION OF sync_events FOR VALUES FROM ('%s') TO ('%s')`,
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return 0, fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		created++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit partitions: %w", err)
+	}
+	return created, nil
+}
+
+// DropPartitionsBefore drops the partitions of sync_events that only hold
+// events created before cutoff. Accounts with events in a dropped partition
+// have their compaction horizon moved past them first, so devices that
+// hadn't caught up get ErrResyncRequired instead of silently missing events.
+// It returns how many partitions were dropped.
+func (r *PostgresSyncEventRepository) DropPartitionsBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, partitionLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock partitions: %w", err)
+	}
+
+	partitions, err := listEventPartitions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, partition := range partitions {
+		if partition.upper.After(cutoff) {
+			break
+		}
+		name := pgx.Identifier{partition.name}.Sanitize()
+
+		query := `UPDATE sync_sequences s
+		          SET compacted_through = GREATEST(s.compacted_through, p.last_sequence), compacted_at = NOW()
+		          FROM (SELECT account_id, MAX(sequence_number) AS last_sequence FROM ` + name + ` GROUP BY account_id) p
+		          WHERE s.account_id = p.account_id`
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return 0, fmt.Errorf("failed to move horizons past partition %s: %w", name, err)
+		}
+		if _, err := tx.Exec(ctx, `DROP TABLE `+name); err != nil {
+			return 0, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		dropped++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit partition drop: %w", err)
+	}
+	return dropped, nil
+}
+
+// listEventPartitions returns the range partitions of sync_events in order
+// of their upper bounds.
+func listEventPartitions(ctx context.Context, db DBTX) ([]eventPartition, error) {
+	query := `SELECT c.relname,
+	                 (regexp_match(pg_get_expr(c.relpartbound, c.oid), 'TO \(''([^'']+)''\)'))[1]::timestamptz AS upper
+	          FROM pg_inherits i
+	          JOIN pg_class c ON c.oid = i.inhrelid
+	          WHERE i.inhparent = 'sync_events'::regclass
+	          ORDER BY upper`
+
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []eventPartition
+	for rows.Next() {
+		var partition eventPartition
+		if err := rows.Scan(&partition.name, &partition.upper); err != nil {
+			return nil, fmt.Errorf("failed to scan event partition: %w", err)
+		}
+		partitions = append(partitions, partition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating event partitions: %w", err)
+	}
+	return partitions, nil
+}
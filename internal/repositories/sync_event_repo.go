@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -11,51 +13,82 @@ import (
 	"github.com/prudhvinik1/edgesync/internal/models"
 )
 
+// ErrResyncRequired is returned when a device asks for events older than the
+// account's compaction horizon. It must rebuild its state from a snapshot and
+// continue from the horizon.
+var ErrResyncRequired = errors.New("events have been compacted: resync required")
+
+// eventColumns is the column list every sync event query selects, in scanEvent order.
+const eventColumns = `id, account_id, owner_account_id, device_id, event_type, COALESCE(state_key, ''), COALESCE(state_version, 0), sequence_number, payload, visible_to, created_at`
+
 type PostgresSyncEventRepository struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	quotas *PostgresQuotaRepository
 }
 
-func NewPostgresSyncEventRepository(pool *pgxpool.Pool) *PostgresSyncEventRepository {
-	return &PostgresSyncEventRepository{pool: pool}
+func NewPostgresSyncEventRepository(pool *pgxpool.Pool, quotas *PostgresQuotaRepository) *PostgresSyncEventRepository {
+	return &PostgresSyncEventRepository{pool: pool, quotas: quotas}
 }
 
-// Append adds a new sync event to the event log.
-// The sequence_number is auto-generated by the database (BIGSERIAL).
+// Append adds a new sync event to the event log, taking the account's next
+// sequence number (see insertSyncEvent).
+// Each event counts against the account's daily event quota, except events
+// the server generates itself, which have no DeviceID.
 func (r *PostgresSyncEventRepository) Append(ctx context.Context, event *models.SyncEvent) error {
-	query := `INSERT INTO sync_events (account_id, device_id, event_type, state_key, payload)
-	          VALUES ($1, $2, $3, $4, $5)
-	          RETURNING id, sequence_number, created_at`
+	return inTx(ctx, r.pool, func(tx *Tx) error {
+		return r.AppendTx(ctx, tx, event)
+	})
+}
 
-	err := r.pool.QueryRow(ctx, query,
-		event.AccountID,
-		event.DeviceID,
-		event.EventType,
-		event.StateKey,
-		event.Payload,
-	).Scan(&event.ID, &event.SequenceNumber, &event.CreatedAt)
+// AppendTx is Append within tx, so the event commits or rolls back together
+// with the change it describes.
+func (r *PostgresSyncEventRepository) AppendTx(ctx context.Context, tx *Tx, event *models.SyncEvent) error {
+	if err := r.charge(ctx, tx, event); err != nil {
+		return err
+	}
+	return insertSyncEvent(ctx, tx, event)
+}
+
+// AppendStateEventTx is AppendTx for an event announcing a write to the
+// state stateID. Accounts with an active share on the state get the event
+// too, in their own streams. Like other server-generated fan-out, their
+// copies don't count against their event quota.
+func (r *PostgresSyncEventRepository) AppendStateEventTx(ctx context.Context, tx *Tx, stateID uuid.UUID, event *models.SyncEvent) error {
+	if err := r.charge(ctx, tx, event); err != nil {
+		return err
+	}
 
+	// Writes to states shared both ways would deadlock if each took its own
+	// account's counter and then the other's, so every counter is locked up
+	// front, in account order, before any number is claimed
+	grantees, err := lockStateSequences(ctx, tx, event.AccountID, stateID)
 	if err != nil {
-		return fmt.Errorf("failed to append sync event: %w", err)
+		return err
 	}
-	return nil
+	if err := insertSyncEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	return notifyGrantees(ctx, tx, grantees, event)
+}
+
+// charge counts event against its account's daily event quota, unless the
+// server generated it. It must come before the event takes its sequence
+// number: writers lock the account's usage row before its sequence counter,
+// so they can't deadlock on the two.
+func (r *PostgresSyncEventRepository) charge(ctx context.Context, tx pgx.Tx, event *models.SyncEvent) error {
+	if event.DeviceID == uuid.Nil {
+		return nil
+	}
+	delta := usageDelta{Events: 1, BlobSize: int64(len(event.Payload))}
+	return r.quotas.charge(ctx, tx, event.AccountID, delta)
 }
 
 func (r *PostgresSyncEventRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.SyncEvent, error) {
-	query := `SELECT id, account_id, device_id, event_type, state_key, sequence_number, payload, created_at
+	query := `SELECT ` + eventColumns + `
 	          FROM sync_events 
 	          WHERE id = $1`
 
-	var event models.SyncEvent
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&event.ID,
-		&event.AccountID,
-		&event.DeviceID,
-		&event.EventType,
-		&event.StateKey,
-		&event.SequenceNumber,
-		&event.Payload,
-		&event.CreatedAt,
-	)
+	event, err := scanEvent(r.pool.QueryRow(ctx, query, id))
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
@@ -63,11 +96,11 @@ func (r *PostgresSyncEventRepository) GetByID(ctx context.Context, id uuid.UUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sync event: %w", err)
 	}
-	return &event, nil
+	return event, nil
 }
 
 func (r *PostgresSyncEventRepository) GetByAccountID(ctx context.Context, accountID uuid.UUID) ([]*models.SyncEvent, error) {
-	query := `SELECT id, account_id, device_id, event_type, state_key, sequence_number, payload, created_at
+	query := `SELECT ` + eventColumns + `
 	          FROM sync_events 
 	          WHERE account_id = $1
 	          ORDER BY sequence_number ASC`
@@ -76,65 +109,303 @@ func (r *PostgresSyncEventRepository) GetByAccountID(ctx context.Context, accoun
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sync events: %w", err)
 	}
-	defer rows.Close()
+	return collectEvents(rows)
+}
 
-	var events []*models.SyncEvent
-	for rows.Next() {
-		var event models.SyncEvent
-		err := rows.Scan(
-			&event.ID,
-			&event.AccountID,
-			&event.DeviceID,
-			&event.EventType,
-			&event.StateKey,
-			&event.SequenceNumber,
-			&event.Payload,
-			&event.CreatedAt,
-		)
+// GetSinceSequence returns up to limit events for an account after the given
+// sequence number that deviceID may receive and that match filter; events
+// about states scoped to other devices are left out.
+// This is the key method for sync - clients say "give me everything since sequence X".
+// If sequenceNumber is older than the account's compaction horizon, events
+// the device hasn't seen may be gone and ErrResyncRequired is returned.
+func (r *PostgresSyncEventRepository) GetSinceSequence(ctx context.Context, accountID, deviceID uuid.UUID, sequenceNumber int64, filter models.EventFilter, limit int) ([]*models.SyncEvent, error) {
+	// One snapshot for the horizon and the events, so a compaction that
+	// commits in between can't remove events after a passing check
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	horizon, err := getHorizon(ctx, tx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if sequenceNumber < horizon {
+		return nil, fmt.Errorf("%w: events up to %d were compacted", ErrResyncRequired, horizon)
+	}
+
+	args := []any{accountID, sequenceNumber, deviceID, limit}
+	query := `SELECT ` + eventColumns + `
+	          FROM sync_events 
+	          WHERE account_id = $1 AND sequence_number > $2 AND ` + visibleTo("$3") +
+		filterConditions(filter, &args) + `
+	          ORDER BY sequence_number ASC
+	          LIMIT $4`
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync events since sequence: %w", err)
+	}
+	return collectEvents(rows)
+}
+
+// filterConditions renders filter as SQL conditions on sync_events, adding
+// its values to args. Each prefix is a separate range condition so the
+// per-account key index can serve it.
+func filterConditions(filter models.EventFilter, args *[]any) string {
+	var sql strings.Builder
+	if len(filter.Prefixes) > 0 {
+		var prefixes []string
+		for _, prefix := range filter.Prefixes {
+			*args = append(*args, prefix)
+			param := fmt.Sprintf("$%d", len(*args))
+			prefixes = append(prefixes, fmt.Sprintf(`(state_key COLLATE "C" >= %s AND starts_with(state_key, %s))`, param, param))
+		}
+		sql.WriteString(" AND (" + strings.Join(prefixes, " OR ") + ")")
+	}
+	if len(filter.EventTypes) > 0 {
+		*args = append(*args, filter.EventTypes)
+		fmt.Fprintf(&sql, " AND event_type = ANY($%d)", len(*args))
+	}
+	return sql.String()
+}
+
+// eventChannel is the Postgres notification channel an account's ID is sent
+// on whenever it gets new events.
+const eventChannel = "sync_events"
+
+// Listen calls notify with the account ID each time new events for an
+// account commit, on any server instance, until ctx is done or the
+// listening connection fails. Notifications sent while not listening are
+// lost, so callers should assume every account has news after an error.
+func (r *PostgresSyncEventRepository) Listen(ctx context.Context, notify func(accountID uuid.UUID)) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire listen connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventChannel); err != nil {
+		return fmt.Errorf("failed to listen for sync events: %w", err)
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN *")
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan sync event: %w", err)
+			return fmt.Errorf("failed to wait for sync events: %w", err)
+		}
+		accountID, err := uuid.Parse(notification.Payload)
+		if err != nil {
+			continue
 		}
-		events = append(events, &event)
+		notify(accountID)
 	}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating sync events: %w", err)
+// GetHorizon returns the account's compaction horizon: the sequence number
+// up to which its events have been compacted, or 0 if they never were.
+func (r *PostgresSyncEventRepository) GetHorizon(ctx context.Context, accountID uuid.UUID) (int64, error) {
+	return getHorizon(ctx, r.pool, accountID)
+}
+
+func getHorizon(ctx context.Context, db DBTX, accountID uuid.UUID) (int64, error) {
+	var horizon int64
+	query := `SELECT COALESCE((SELECT compacted_through FROM sync_sequences WHERE account_id = $1), 0)`
+	if err := db.QueryRow(ctx, query, accountID).Scan(&horizon); err != nil {
+		return 0, fmt.Errorf("failed to get compaction horizon: %w", err)
 	}
+	return horizon, nil
+}
 
-	return events, nil
+// Compact moves the compaction horizon of up to limit accounts to their last
+// event created before cutoff, and drops every event up to the horizon except
+// the latest one for each state key. It returns how many accounts were
+// compacted and how many events were dropped.
+func (r *PostgresSyncEventRepository) Compact(ctx context.Context, cutoff time.Time, limit int) (accounts, dropped int64, err error) {
+	query := `WITH horizons AS (
+	              SELECT s.account_id, h.horizon
+	              FROM sync_sequences s
+	              CROSS JOIN LATERAL (
+	                  SELECT MAX(e.sequence_number) AS horizon
+	                  FROM sync_events e
+	                  WHERE e.account_id = s.account_id AND e.created_at < $1
+	              ) h
+	              WHERE h.horizon > s.compacted_through
+	              ORDER BY s.account_id
+	              LIMIT $2
+	          ),
+	          moved AS (
+	              UPDATE sync_sequences s
+	              SET compacted_through = h.horizon, compacted_at = NOW()
+	              FROM horizons h
+	              WHERE s.account_id = h.account_id
+	              RETURNING s.account_id, s.compacted_through
+	          ),
+	          superseded AS (
+	              SELECT id FROM (
+	                  SELECT e.id, ROW_NUMBER() OVER (
+	                             PARTITION BY e.account_id, e.owner_account_id, e.state_key
+	                             ORDER BY e.sequence_number DESC
+	                         ) AS newer
+	                  FROM sync_events e
+	                  JOIN moved m ON m.account_id = e.account_id AND e.sequence_number <= m.compacted_through
+	              ) ranked
+	              WHERE newer > 1
+	          ),
+	          deleted AS (
+	              DELETE FROM sync_events WHERE id IN (SELECT id FROM superseded)
+	              RETURNING 1
+	          )
+	          SELECT (SELECT COUNT(*) FROM moved), (SELECT COUNT(*) FROM deleted)`
+
+	if err := r.pool.QueryRow(ctx, query, cutoff, limit).Scan(&accounts, &dropped); err != nil {
+		return 0, 0, fmt.Errorf("failed to compact sync events: %w", err)
+	}
+	return accounts, dropped, nil
 }
 
-// GetSinceSequence returns all events for an account after the given sequence number.
-// This is the key method for sync - clients say "give me everything since sequence X".
-func (r *PostgresSyncEventRepository) GetSinceSequence(ctx context.Context, accountID uuid.UUID, sequenceNumber int64) ([]*models.SyncEvent, error) {
-	query := `SELECT id, account_id, device_id, event_type, state_key, sequence_number, payload, created_at
-	          FROM sync_events 
-	          WHERE account_id = $1 AND sequence_number > $2
-	          ORDER BY sequence_number ASC`
+// claimSequence is a CTE, seq, that takes the next sequence number of the
+// account in $1. The account's counter row stays locked until the
+// transaction ends, so other writers to the account wait and numbers commit
+// in order, without gaps.
+const claimSequence = `seq AS (
+	              INSERT INTO sync_sequences AS s (account_id, last_sequence) VALUES ($1, 1)
+	              ON CONFLICT (account_id) DO UPDATE SET last_sequence = s.last_sequence + 1
+	              RETURNING last_sequence
+	          )`
+
+// insertSyncEvent writes an event using db, which may be a transaction shared
+// with the state change the event describes. A zero DeviceID is stored as
+// NULL for events the server generates itself. db must be a transaction (or
+// autocommit) that ends promptly: it holds the account's sequence counter.
+func insertSyncEvent(ctx context.Context, db DBTX, event *models.SyncEvent) error {
+	query := `WITH ` + claimSequence + `
+	          INSERT INTO sync_events (account_id, owner_account_id, device_id, event_type, state_key, state_version, payload, visible_to, sequence_number)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, (SELECT last_sequence FROM seq))
+	          RETURNING id, sequence_number, created_at`
+
+	var deviceID *uuid.UUID
+	if event.DeviceID != uuid.Nil {
+		deviceID = &event.DeviceID
+	}
+
+	err := db.QueryRow(ctx, query,
+		event.AccountID,
+		event.OwnerAccountID,
+		deviceID,
+		event.EventType,
+		event.StateKey,
+		event.StateVersion,
+		event.Payload,
+		event.VisibleTo,
+	).Scan(&event.ID, &event.SequenceNumber, &event.CreatedAt)
 
-	rows, err := r.pool.Query(ctx, query, accountID, sequenceNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query sync events since sequence: %w", err)
+		return fmt.Errorf("failed to append sync event: %w", err)
+	}
+	return nil
+}
+
+// lockStateSequences locks the sequence counters of the owner accountID and
+// of every account with an active share on the state stateID, in account
+// order, creating the ones that don't exist yet. It returns the grantees,
+// so their events go to exactly the accounts whose counters are held.
+func lockStateSequences(ctx context.Context, db DBTX, accountID, stateID uuid.UUID) ([]uuid.UUID, error) {
+	// The no-op update locks existing rows; rows are visited in account order
+	query := `WITH accounts AS (
+	              SELECT $1::uuid AS account_id
+	              UNION
+	              SELECT g.grantee_account_id FROM state_shares g
+	              WHERE g.state_id = $2 AND ` + activeShare + `
+	          )
+	          INSERT INTO sync_sequences AS s (account_id, last_sequence)
+	          SELECT account_id, 0 FROM accounts
+	          ORDER BY account_id
+	          ON CONFLICT (account_id) DO UPDATE SET last_sequence = s.last_sequence
+	          RETURNING account_id`
+
+	rows, err := db.Query(ctx, query, accountID, stateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock sequences: %w", err)
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock sequences: %w", err)
+	}
+
+	var grantees []uuid.UUID
+	for _, id := range locked {
+		if id != accountID {
+			grantees = append(grantees, id)
+		}
+	}
+	return grantees, nil
+}
+
+// notifyGrantees copies event to the streams of grantees, whose sequence
+// counters the transaction must already hold (see lockStateSequences).
+func notifyGrantees(ctx context.Context, db DBTX, grantees []uuid.UUID, event *models.SyncEvent) error {
+	if len(grantees) == 0 {
+		return nil
+	}
+
+	query := `WITH seq AS (
+	              UPDATE sync_sequences s
+	              SET last_sequence = s.last_sequence + 1
+	              WHERE s.account_id = ANY($1)
+	              RETURNING account_id, last_sequence
+	          )
+	          INSERT INTO sync_events (account_id, owner_account_id, device_id, event_type, state_key, state_version, sequence_number)
+	          SELECT seq.account_id, $2, $3, $4, $5, $6, seq.last_sequence
+	          FROM seq`
+
+	var deviceID *uuid.UUID
+	if event.DeviceID != uuid.Nil {
+		deviceID = &event.DeviceID
+	}
+
+	_, err := db.Exec(ctx, query, grantees, event.AccountID, deviceID, event.EventType, event.StateKey, event.StateVersion)
+	if err != nil {
+		return fmt.Errorf("failed to notify grantees: %w", err)
 	}
+	return nil
+}
+
+// scanEvent reads one row selected with eventColumns.
+func scanEvent(row pgx.Row) (*models.SyncEvent, error) {
+	var event models.SyncEvent
+	err := row.Scan(
+		&event.ID,
+		&event.AccountID,
+		&event.OwnerAccountID,
+		&event.DeviceID,
+		&event.EventType,
+		&event.StateKey,
+		&event.StateVersion,
+		&event.SequenceNumber,
+		&event.Payload,
+		&event.VisibleTo,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// collectEvents scans and closes rows selected with eventColumns.
+func collectEvents(rows pgx.Rows) ([]*models.SyncEvent, error) {
 	defer rows.Close()
 
 	var events []*models.SyncEvent
 	for rows.Next() {
-		var event models.SyncEvent
-		err := rows.Scan(
-			&event.ID,
-			&event.AccountID,
-			&event.DeviceID,
-			&event.EventType,
-			&event.StateKey,
-			&event.SequenceNumber,
-			&event.Payload,
-			&event.CreatedAt,
-		)
+		event, err := scanEvent(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan sync event: %w", err)
 		}
-		events = append(events, &event)
+		events = append(events, event)
 	}
 
 	if err := rows.Err(); err != nil {
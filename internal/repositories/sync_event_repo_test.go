@@ -0,0 +1,342 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSyncEventRepository_PerAccountSequences tests that each account numbers its events 1, 2, 3, ... without gaps
+func TestSyncEventRepository_PerAccountSequences(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+	otherID, otherDevice := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, otherID)
+
+	// ARRANGE: Another account's events don't take numbers from ours
+	require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: otherID, DeviceID: otherDevice, EventType: models.EventTypeUpdate, StateKey: "a"}))
+
+	// ACT: Append concurrently
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: models.EventTypeUpdate, StateKey: "a"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// ASSERT: Numbers start at 1 and have no gaps or duplicates
+	events, err := eventRepo.GetByAccountID(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, events, writers)
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.SequenceNumber)
+	}
+
+	// A rolled back append gives its number back
+	require.NoError(t, quotaRepo.SetLimits(ctx, accountID, &models.QuotaLimits{MaxEventsPerDay: writers}))
+	err = eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: models.EventTypeUpdate, StateKey: "a"})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	require.NoError(t, quotaRepo.SetLimits(ctx, accountID, &models.QuotaLimits{}))
+	next := &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: models.EventTypeUpdate, StateKey: "a"}
+	require.NoError(t, eventRepo.Append(ctx, next))
+	assert.Equal(t, int64(writers+1), next.SequenceNumber)
+}
+
+// TestSyncEventRepository_GetSinceSequencePages tests that catch-up reads are bounded by the limit
+func TestSyncEventRepository_GetSinceSequencePages(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: models.EventTypeUpdate, StateKey: "a"}))
+	}
+
+	// ACT: Read two pages of two
+	first, err := eventRepo.GetSinceSequence(ctx, accountID, deviceID, 0, models.EventFilter{}, 2)
+	require.NoError(t, err)
+	second, err := eventRepo.GetSinceSequence(ctx, accountID, deviceID, first[len(first)-1].SequenceNumber, models.EventFilter{}, 2)
+	require.NoError(t, err)
+
+	// ASSERT: Pages continue from the cursor without overlap
+	require.Len(t, first, 2)
+	require.Len(t, second, 2)
+	assert.Equal(t, []int64{1, 2, 3, 4}, []int64{
+		first[0].SequenceNumber, first[1].SequenceNumber,
+		second[0].SequenceNumber, second[1].SequenceNumber,
+	})
+}
+
+// TestSyncEventRepository_CompactsBehindHorizon tests that compaction keeps the latest event per key and forces old cursors to resync
+func TestSyncEventRepository_CompactsBehindHorizon(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	// ARRANGE: Three old events (two for "a") and a recent one
+	for _, key := range []string{"a", "b", "a", "a"} {
+		require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: models.EventTypeUpdate, StateKey: key}))
+	}
+	_, err := pool.Exec(ctx, `UPDATE sync_events SET created_at = NOW() - INTERVAL '2 days' WHERE account_id = $1 AND sequence_number <= 3`, accountID)
+	require.NoError(t, err)
+
+	// ACT: Compact everything older than a day
+	for {
+		accounts, _, err := eventRepo.Compact(ctx, time.Now().Add(-24*time.Hour), 100)
+		require.NoError(t, err)
+		if accounts < 100 {
+			break
+		}
+	}
+
+	// ASSERT: The horizon is the last old event, and only the superseded "a" is gone
+	horizon, err := eventRepo.GetHorizon(ctx, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), horizon)
+
+	events, err := eventRepo.GetByAccountID(ctx, accountID)
+	require.NoError(t, err)
+	var sequences []int64
+	for _, event := range events {
+		sequences = append(sequences, event.SequenceNumber)
+	}
+	assert.Equal(t, []int64{2, 3, 4}, sequences)
+
+	// Cursors behind the horizon must resync; cursors at it continue normally
+	_, err = eventRepo.GetSinceSequence(ctx, accountID, deviceID, 0, models.EventFilter{}, 100)
+	assert.ErrorIs(t, err, ErrResyncRequired)
+
+	recent, err := eventRepo.GetSinceSequence(ctx, accountID, deviceID, 3, models.EventFilter{}, 100)
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, int64(4), recent[0].SequenceNumber)
+}
+
+// TestSyncEventRepository_EnsurePartitions tests that upcoming months get partitions exactly once
+func TestSyncEventRepository_EnsurePartitions(t *testing.T) {
+	pool := getTestPool(t)
+	eventRepo := NewPostgresSyncEventRepository(pool, NewPostgresQuotaRepository(pool, models.QuotaLimits{}))
+	ctx := context.Background()
+
+	// ACT: Ensure the same window twice
+	_, err := eventRepo.EnsurePartitions(ctx, time.Now(), 3)
+	require.NoError(t, err)
+	created, err := eventRepo.EnsurePartitions(ctx, time.Now(), 3)
+
+	// ASSERT: The second run finds every month covered
+	require.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	partitions, err := listEventPartitions(ctx, pool)
+	require.NoError(t, err)
+	require.NotEmpty(t, partitions)
+	now := time.Now().UTC()
+	lastMonth := time.Date(now.Year(), now.Month()+4, 1, 0, 0, 0, 0, time.UTC)
+	assert.False(t, partitions[len(partitions)-1].upper.Before(lastMonth), "Partitions should reach three months ahead")
+}
+
+// TestSyncEventRepository_FiltersByPrefixAndType tests that catch-up can be narrowed to key prefixes and event types
+func TestSyncEventRepository_FiltersByPrefixAndType(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, accountID)
+
+	appends := []struct{ key, eventType string }{
+		{"photos/a", models.EventTypeCreate},
+		{"notes/a", models.EventTypeCreate},
+		{"photos/a", models.EventTypeDelete},
+		{"docs/a", models.EventTypeDelete},
+		{"photosynth", models.EventTypeCreate},
+	}
+	for _, a := range appends {
+		require.NoError(t, eventRepo.Append(ctx, &models.SyncEvent{AccountID: accountID, DeviceID: deviceID, EventType: a.eventType, StateKey: a.key}))
+	}
+
+	keys := func(filter models.EventFilter) []string {
+		events, err := eventRepo.GetSinceSequence(ctx, accountID, deviceID, 0, filter, 100)
+		require.NoError(t, err)
+		var keys []string
+		for _, event := range events {
+			keys = append(keys, event.StateKey+":"+event.EventType)
+		}
+		return keys
+	}
+
+	// ACT & ASSERT: Prefixes, types, and both together
+	assert.Equal(t, []string{"photos/a:create", "photos/a:delete"}, keys(models.EventFilter{Prefixes: []string{"photos/"}}))
+	assert.Equal(t, []string{"photos/a:create", "notes/a:create", "photos/a:delete"}, keys(models.EventFilter{Prefixes: []string{"photos/", "notes/"}}))
+	assert.Equal(t, []string{"photos/a:delete", "docs/a:delete"}, keys(models.EventFilter{EventTypes: []string{models.EventTypeDelete}}))
+	assert.Equal(t, []string{"photos/a:delete"}, keys(models.EventFilter{Prefixes: []string{"photos/"}, EventTypes: []string{models.EventTypeDelete}}))
+	assert.Len(t, keys(models.EventFilter{}), len(appends))
+}
+
+// TestSyncEventRepository_StateEventsReachGrantees tests that a state's events are copied to the accounts it is shared with
+func TestSyncEventRepository_StateEventsReachGrantees(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	stateRepo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	shareRepo := NewPostgresShareRepository(pool)
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	ctx := context.Background()
+
+	ownerID, ownerDevice := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, ownerID)
+	granteeID, _ := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+	defer cleanupTestData(t, pool, ctx, granteeID)
+
+	state := &models.EncryptedState{AccountID: ownerID, DeviceID: ownerDevice, Key: "notes/shared", State: []byte("v1"), Nonce: []byte("n")}
+	require.NoError(t, stateRepo.Upsert(ctx, state))
+	require.NoError(t, shareRepo.Grant(ctx, &models.StateShare{
+		StateID:          state.ID,
+		OwnerAccountID:   ownerID,
+		GranteeAccountID: granteeID,
+		Permission:       models.SharePermissionRead,
+		WrappedKey:       []byte("wrapped"),
+	}))
+
+	// ACT: Append an update event for the state
+	tx, err := NewPostgresTransactor(pool).Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	event := &models.SyncEvent{AccountID: ownerID, DeviceID: ownerDevice, EventType: models.EventTypeUpdate, StateKey: "notes/shared", StateVersion: 2}
+	require.NoError(t, eventRepo.AppendStateEventTx(ctx, tx, state.ID, event))
+	require.NoError(t, tx.Commit(ctx))
+
+	// ASSERT: The owner has the event and the grantee a copy naming the owner, uncharged
+	owned, err := eventRepo.GetByAccountID(ctx, ownerID)
+	require.NoError(t, err)
+	require.Len(t, owned, 1)
+	assert.Equal(t, models.EventTypeUpdate, owned[0].EventType)
+
+	received, err := eventRepo.GetByAccountID(ctx, granteeID)
+	require.NoError(t, err)
+	require.Len(t, received, 2, "The grant and the update")
+	assert.Equal(t, models.EventTypeUpdate, received[1].EventType)
+	assert.Equal(t, int64(2), received[1].StateVersion)
+	require.NotNil(t, received[1].OwnerAccountID)
+	assert.Equal(t, ownerID, *received[1].OwnerAccountID)
+
+	usage, err := quotaRepo.GetUsage(ctx, granteeID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.EventsToday)
+}
+
+// TestSyncEventRepository_CrossSharedWritesDontDeadlock tests that accounts sharing states with each other can write concurrently
+func TestSyncEventRepository_CrossSharedWritesDontDeadlock(t *testing.T) {
+	pool := getTestPool(t)
+	quotaRepo := NewPostgresQuotaRepository(pool, models.QuotaLimits{})
+	stateRepo := NewPostgresEncryptedStateRepository(pool, quotaRepo)
+	shareRepo := NewPostgresShareRepository(pool)
+	eventRepo := NewPostgresSyncEventRepository(pool, quotaRepo)
+	accountRepo := NewPostgresAccountRepository(pool)
+	deviceRepo := NewPostgresDeviceRepository(pool)
+	txs := NewPostgresTransactor(pool)
+	ctx := context.Background()
+
+	// ARRANGE: Two accounts, each sharing a state with the other
+	type side struct {
+		accountID, deviceID uuid.UUID
+		state               *models.EncryptedState
+	}
+	sides := make([]*side, 2)
+	for i := range sides {
+		accountID, deviceID := setupTestAccountAndDevice(t, ctx, pool, accountRepo, deviceRepo)
+		defer cleanupTestData(t, pool, ctx, accountID)
+		state := &models.EncryptedState{AccountID: accountID, DeviceID: deviceID, Key: "notes/shared", State: []byte("v"), Nonce: []byte("n")}
+		require.NoError(t, stateRepo.Upsert(ctx, state))
+		sides[i] = &side{accountID: accountID, deviceID: deviceID, state: state}
+	}
+	for i, s := range sides {
+		require.NoError(t, shareRepo.Grant(ctx, &models.StateShare{
+			StateID:          s.state.ID,
+			OwnerAccountID:   s.accountID,
+			GranteeAccountID: sides[1-i].accountID,
+			Permission:       models.SharePermissionRead,
+			WrappedKey:       []byte("wrapped"),
+		}))
+	}
+
+	// ACT: Both owners announce writes at the same time, holding their counters a moment
+	const writes = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writes)
+	for _, s := range sides {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				errs <- func() error {
+					tx, err := txs.Begin(ctx)
+					if err != nil {
+						return err
+					}
+					defer tx.Rollback(ctx)
+					event := &models.SyncEvent{AccountID: s.accountID, DeviceID: s.deviceID, EventType: models.EventTypeUpdate, StateKey: "notes/shared", StateVersion: int64(i + 2)}
+					if err := eventRepo.AppendStateEventTx(ctx, tx, s.state.ID, event); err != nil {
+						return err
+					}
+					time.Sleep(time.Millisecond)
+					return tx.Commit(ctx)
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// ASSERT: No write failed, and each stream is numbered without gaps
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	for _, s := range sides {
+		events, err := eventRepo.GetByAccountID(ctx, s.accountID)
+		require.NoError(t, err)
+		require.Len(t, events, 1+2*writes, "The grant plus both sides' updates")
+		for i, event := range events {
+			assert.Equal(t, int64(i+1), event.SequenceNumber)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const waiterPrefix = "waiters:"
+
+// waiterAcquireScript adds waiter ARGV[3] to the sorted set at KEYS[1] unless
+// it already holds ARGV[1] unexpired waiters. Members are scored by their
+// expiry, ARGV[2] ms from now on the Redis clock, so the slots of an
+// instance that died without releasing them free themselves. Returns 1 if
+// the waiter was added, 0 if the account is full.
+var waiterAcquireScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[3])
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RedisWaiterRepository counts the requests waiting for each account's
+// events in Redis, so a per-account limit holds across server instances.
+type RedisWaiterRepository struct {
+	client *redis.Client
+}
+
+func NewRedisWaiterRepository(client *redis.Client) *RedisWaiterRepository {
+	return &RedisWaiterRepository{client: client}
+}
+
+// Acquire takes one of limit waiter slots of accountID for waiterID,
+// reporting false if all are taken. The slot is held until released or for
+// at most ttl.
+func (r *RedisWaiterRepository) Acquire(ctx context.Context, accountID, waiterID uuid.UUID, limit int, ttl time.Duration) (bool, error) {
+	acquired, err := waiterAcquireScript.Run(ctx, r.client, []string{waiterKey(accountID)},
+		limit, ttl.Milliseconds(), waiterID.String()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire waiter slot: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+// Release frees the slot held by waiterID.
+func (r *RedisWaiterRepository) Release(ctx context.Context, accountID, waiterID uuid.UUID) error {
+	if err := r.client.ZRem(ctx, waiterKey(accountID), waiterID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to release waiter slot: %w", err)
+	}
+	return nil
+}
+
+func waiterKey(accountID uuid.UUID) string {
+	return waiterPrefix + accountID.String()
+}
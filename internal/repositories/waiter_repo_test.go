@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWaiterRepository_LimitsSlots tests that an account's waiter slots are limited until released or expired
+func TestWaiterRepository_LimitsSlots(t *testing.T) {
+	client := getTestRedisClient(t)
+	repo := NewRedisWaiterRepository(client)
+	ctx := context.Background()
+
+	accountID := uuid.New()
+	defer client.Del(ctx, waiterKey(accountID))
+
+	// ARRANGE: Take both slots, one of them briefly
+	first := uuid.New()
+	acquired, err := repo.Acquire(ctx, accountID, first, 2, time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	acquired, err = repo.Acquire(ctx, accountID, uuid.New(), 2, 200*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// ACT: Try a third
+	acquired, err = repo.Acquire(ctx, accountID, uuid.New(), 2, time.Minute)
+
+	// ASSERT: Refused while both are held
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Releasing frees a slot
+	require.NoError(t, repo.Release(ctx, accountID, first))
+	acquired, err = repo.Acquire(ctx, accountID, uuid.New(), 2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// So does a slot expiring, as when its instance dies
+	time.Sleep(300 * time.Millisecond)
+	acquired, err = repo.Acquire(ctx, accountID, uuid.New(), 2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
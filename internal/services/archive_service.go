@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+// ArchiveService exports accounts to signed portable archives and imports
+// them on another server.
+type ArchiveService struct {
+	archiveRepo    repositories.ArchiveRepository
+	signingKey     ed25519.PrivateKey
+	trustedKeys    []ed25519.PublicKey
+	allowUntrusted bool
+}
+
+// NewArchiveService creates an ArchiveService that signs exports with
+// signingKey. Imports must be signed by one of trustedKeys; with no trusted
+// keys they are refused, unless untrusted signers are allowed.
+func NewArchiveService(archiveRepo repositories.ArchiveRepository, signingKey ed25519.PrivateKey, trustedKeys []ed25519.PublicKey) *ArchiveService {
+	return &ArchiveService{
+		archiveRepo: archiveRepo,
+		signingKey:  signingKey,
+		trustedKeys: trustedKeys,
+	}
+}
+
+// AllowUntrustedSigners lets Import accept any correctly signed archive when
+// there are no trusted keys, for operators moving data between their own
+// servers by hand.
+func (s *ArchiveService) AllowUntrustedSigners() *ArchiveService {
+	s.allowUntrusted = true
+	return s
+}
+
+// Export writes a signed archive of the account to out. Nothing is written
+// to out unless the account was read successfully. The password hash is
+// only included with includeCredentials, for operator-driven migrations.
+func (s *ArchiveService) Export(ctx context.Context, accountID uuid.UUID, out io.Writer, includeCredentials bool) error {
+	w := archive.NewWriter(out, s.signingKey)
+	defer w.Close()
+
+	if err := s.archiveRepo.Export(ctx, accountID, w, includeCredentials); err != nil {
+		return err
+	}
+	return w.Finish(accountID)
+}
+
+// Import verifies an archive and recreates its account under new IDs. A
+// non-empty email replaces the archived one, e.g. when it is taken.
+func (s *ArchiveService) Import(ctx context.Context, in io.Reader, email string) (*models.Account, error) {
+	if len(s.trustedKeys) == 0 && !s.allowUntrusted {
+		return nil, fmt.Errorf("%w: no trusted keys are configured", archive.ErrUntrustedSigner)
+	}
+
+	r, err := archive.NewReader(in, s.trustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.archiveRepo.Import(ctx, r, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import archive: %w", err)
+	}
+	return account, nil
+}
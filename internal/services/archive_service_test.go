@@ -0,0 +1,25 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/prudhvinik1/edgesync/internal/archive"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestArchiveService_RefusesImportsWithoutTrustedKeys tests that imports need trusted keys unless untrusted signers are allowed
+func TestArchiveService_RefusesImportsWithoutTrustedKeys(t *testing.T) {
+	service := NewArchiveService(nil, nil, nil)
+
+	// ACT
+	_, err := service.Import(context.Background(), bytes.NewReader(nil), "")
+
+	// ASSERT: Refused before the archive is read
+	assert.ErrorIs(t, err, archive.ErrUntrustedSigner)
+
+	// Allowing untrusted signers gets as far as reading it
+	_, err = service.AllowUntrustedSigners().Import(context.Background(), bytes.NewReader(nil), "")
+	assert.ErrorIs(t, err, archive.ErrInvalidArchive)
+}
@@ -231,6 +231,52 @@ func (s *AuthService) VerifyToken(tokenString string) (*TokenClaims, error) {
 	}, nil
 }
 
+// Authenticate verifies a token and checks that its session is still active,
+// so tokens stop working as soon as the user logs out.
+func (s *AuthService) Authenticate(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	claims, err := s.VerifyToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if err == repositories.ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return claims, nil
+}
+
+// CheckSession reports whether authenticated claims are still good: their
+// session hasn't ended and their device hasn't been revoked. Long-lived
+// connections call it periodically, since they outlive the request-time
+// check in Authenticate. It returns ErrInvalidToken when they are not.
+func (s *AuthService) CheckSession(ctx context.Context, claims *TokenClaims) error {
+	_, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if err == repositories.ErrNotFound {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	device, err := s.deviceRepo.GetByID(ctx, claims.DeviceID)
+	if err == repositories.ErrNotFound {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	if device.RevokedAt != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
 func (s *AuthService) Logout(ctx context.Context, tokenString string) error {
 	claims, err := s.VerifyToken(tokenString)
 	if err != nil {
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+var (
+	ErrInvalidChunkHash  = errors.New("chunk hash must be a lowercase hex SHA-256 digest")
+	ErrChunkHashMismatch = errors.New("chunk data does not match its hash")
+	ErrChunkTooLarge     = errors.New("chunk exceeds maximum size")
+)
+
+// ChunkService stores the content-addressed chunks that large states are
+// split into. Clients upload chunks first, then commit a state that lists
+// them in order (see SyncService.Put).
+type ChunkService struct {
+	chunkRepo     repositories.ChunkRepository
+	maxChunkSize  int
+	gcGracePeriod time.Duration
+}
+
+func NewChunkService(chunkRepo repositories.ChunkRepository, maxChunkSize int, gcGracePeriod time.Duration) *ChunkService {
+	return &ChunkService{
+		chunkRepo:     chunkRepo,
+		maxChunkSize:  maxChunkSize,
+		gcGracePeriod: gcGracePeriod,
+	}
+}
+
+// MaxChunkSize is the largest chunk PutChunk accepts, in bytes.
+func (s *ChunkService) MaxChunkSize() int {
+	return s.maxChunkSize
+}
+
+// PutChunk verifies the chunk against its hash and stores it. Uploading a
+// chunk that already exists succeeds, which makes retries safe.
+func (s *ChunkService) PutChunk(ctx context.Context, accountID uuid.UUID, hash string, data []byte) error {
+	if !validChunkHash(hash) {
+		return ErrInvalidChunkHash
+	}
+	if len(data) > s.maxChunkSize {
+		return ErrChunkTooLarge
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return ErrChunkHashMismatch
+	}
+
+	chunk := &models.Chunk{
+		AccountID: accountID,
+		Hash:      hash,
+		Data:      data,
+	}
+	if err := s.chunkRepo.Put(ctx, chunk); err != nil {
+		return fmt.Errorf("failed to store chunk: %w", err)
+	}
+	return nil
+}
+
+func (s *ChunkService) GetChunk(ctx context.Context, accountID uuid.UUID, hash string) (*models.Chunk, error) {
+	if !validChunkHash(hash) {
+		return nil, ErrInvalidChunkHash
+	}
+	return s.chunkRepo.Get(ctx, accountID, hash)
+}
+
+// MissingChunks tells a client which chunks of a planned state it still has
+// to upload. Calling it again after an interrupted upload resumes from where
+// the client left off.
+func (s *ChunkService) MissingChunks(ctx context.Context, accountID uuid.UUID, hashes []string) ([]string, error) {
+	for _, hash := range hashes {
+		if !validChunkHash(hash) {
+			return nil, ErrInvalidChunkHash
+		}
+	}
+	return s.chunkRepo.Missing(ctx, accountID, hashes)
+}
+
+// CollectGarbage deletes chunks that no state references anymore. Chunks
+// touched within the grace period are kept so in-progress uploads survive.
+func (s *ChunkService) CollectGarbage(ctx context.Context) (int64, error) {
+	return s.chunkRepo.DeleteUnreferenced(ctx, time.Now().Add(-s.gcGracePeriod))
+}
+
+// RunGarbageCollector calls CollectGarbage every interval until ctx is done.
+func (s *ChunkService) RunGarbageCollector(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.CollectGarbage(ctx)
+			if err != nil {
+				log.Printf("chunk garbage collection failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("chunk garbage collection removed %d chunks", deleted)
+			}
+		}
+	}
+}
+
+// validChunkHash reports whether hash is a lowercase hex SHA-256 digest.
+func validChunkHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+// DeviceService reports on an account's devices and tracks which of them
+// are online.
+type DeviceService struct {
+	deviceRepo   repositories.DeviceRepository
+	presenceRepo repositories.PresenceRepository
+}
+
+func NewDeviceService(deviceRepo repositories.DeviceRepository, presenceRepo repositories.PresenceRepository) *DeviceService {
+	return &DeviceService{deviceRepo: deviceRepo, presenceRepo: presenceRepo}
+}
+
+// Heartbeat marks a device online. It stays online until Disconnect, or
+// until heartbeats stop for the presence TTL.
+func (s *DeviceService) Heartbeat(ctx context.Context, accountID, deviceID uuid.UUID) error {
+	return s.presenceRepo.SetPresence(ctx, &models.Presence{
+		AccountID: accountID,
+		DeviceID:  deviceID,
+		Status:    string(models.StatusOnline),
+	})
+}
+
+// Disconnect marks a device offline.
+func (s *DeviceService) Disconnect(ctx context.Context, deviceID uuid.UUID) error {
+	return s.presenceRepo.DeletePresence(ctx, deviceID)
+}
+
+// List returns the account's devices with their sync cursors and lag, so
+// devices that have stopped syncing stand out.
+func (s *DeviceService) List(ctx context.Context, accountID uuid.UUID) ([]*models.DeviceStatus, error) {
+	statuses, err := s.deviceRepo.GetSyncStatusByAccountID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if statuses == nil {
+		statuses = []*models.DeviceStatus{}
+	}
+	return statuses, nil
+}
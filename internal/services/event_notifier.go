@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+const (
+	// listenRetryDelay is how long the notifier waits before listening again
+	// after its connection fails.
+	listenRetryDelay = time.Second
+
+	// waiterSlotTTL bounds how long a shared waiter slot outlives an instance
+	// that dies while holding it. Waiters hold slots for at most MaxEventWait.
+	waiterSlotTTL = MaxEventWait + 15*time.Second
+
+	// waiterReleaseTimeout bounds giving a shared waiter slot back.
+	waiterReleaseTimeout = 5 * time.Second
+)
+
+var ErrTooManyWaiters = errors.New("too many requests are already waiting for this account's events")
+
+// EventNotifier wakes readers waiting for an account's next events. It is
+// fed by a listener that hears about new events from every server instance.
+type EventNotifier struct {
+	maxWaiters int
+	slots      repositories.WaiterRepository
+
+	mu       sync.Mutex
+	accounts map[uuid.UUID]*accountWaiters
+}
+
+// accountWaiters is the wakeup channel of one account's waiters. Notifying
+// closes it, waking everyone at once; the next waiter gets a fresh one.
+type accountWaiters struct {
+	woken    chan struct{}
+	count    int
+	watchers int
+}
+
+// NewEventNotifier creates an EventNotifier that lets at most maxWaiters
+// readers per account wait at once. 0 means no limit. The limit is counted
+// in slots, shared by every instance using the same store; with nil slots
+// it is counted, and holds, per instance.
+func NewEventNotifier(maxWaiters int, slots repositories.WaiterRepository) *EventNotifier {
+	return &EventNotifier{maxWaiters: maxWaiters, slots: slots, accounts: make(map[uuid.UUID]*accountWaiters)}
+}
+
+// EventWaiter is one reader's registration with an EventNotifier.
+type EventWaiter struct {
+	notifier  *EventNotifier
+	accountID uuid.UUID
+	id        uuid.UUID
+	slot      bool
+	watcher   bool
+	released  bool
+}
+
+// Subscribe registers a waiter for accountID, or returns ErrTooManyWaiters.
+// If the shared slots can't be reached, the limit is counted per instance
+// instead. The waiter must be released when done.
+func (n *EventNotifier) Subscribe(ctx context.Context, accountID uuid.UUID) (*EventWaiter, error) {
+	waiter := &EventWaiter{notifier: n, accountID: accountID, id: uuid.New()}
+	if n.maxWaiters > 0 && n.slots != nil {
+		acquired, err := n.slots.Acquire(ctx, accountID, waiter.id, n.maxWaiters, waiterSlotTTL)
+		if err != nil {
+			log.Printf("event notifier: failed to acquire waiter slot, limiting per instance: %v", err)
+		} else if !acquired {
+			return nil, ErrTooManyWaiters
+		} else {
+			waiter.slot = true
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	waiters := n.waiters(accountID)
+	if !waiter.slot && n.maxWaiters > 0 && waiters.count >= n.maxWaiters {
+		return nil, ErrTooManyWaiters
+	}
+	waiters.count++
+	return waiter, nil
+}
+
+// Watch registers a long-lived waiter for accountID, such as a socket that
+// streams events. Watchers don't count towards the waiter limit. The waiter
+// must be released when done.
+func (n *EventNotifier) Watch(accountID uuid.UUID) *EventWaiter {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.waiters(accountID).watchers++
+	return &EventWaiter{notifier: n, accountID: accountID, watcher: true}
+}
+
+// waiters returns the account's waiters, creating them if needed. n.mu must
+// be held.
+func (n *EventNotifier) waiters(accountID uuid.UUID) *accountWaiters {
+	waiters := n.accounts[accountID]
+	if waiters == nil {
+		waiters = &accountWaiters{woken: make(chan struct{})}
+		n.accounts[accountID] = waiters
+	}
+	return waiters
+}
+
+// Woken returns a channel that is closed by the next notification for the
+// waiter's account. Take it before reading events, so events committed
+// after the read still wake the waiter.
+func (w *EventWaiter) Woken() <-chan struct{} {
+	w.notifier.mu.Lock()
+	defer w.notifier.mu.Unlock()
+	return w.notifier.accounts[w.accountID].woken
+}
+
+// Release unregisters the waiter and gives back its slot.
+func (w *EventWaiter) Release() {
+	if !w.unregister() || !w.slot {
+		return
+	}
+
+	// The request's context may be done by now
+	ctx, cancel := context.WithTimeout(context.Background(), waiterReleaseTimeout)
+	defer cancel()
+	if err := w.notifier.slots.Release(ctx, w.accountID, w.id); err != nil {
+		log.Printf("failed to release waiter slot, it expires on its own: %v", err)
+	}
+}
+
+// unregister removes the waiter from its account, reporting false if it
+// was already released.
+func (w *EventWaiter) unregister() bool {
+	n := w.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if w.released {
+		return false
+	}
+	w.released = true
+
+	waiters := n.accounts[w.accountID]
+	if w.watcher {
+		waiters.watchers--
+	} else {
+		waiters.count--
+	}
+	if waiters.count == 0 && waiters.watchers == 0 {
+		delete(n.accounts, w.accountID)
+	}
+	return true
+}
+
+// Notify wakes every waiter of accountID.
+func (n *EventNotifier) Notify(accountID uuid.UUID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if waiters := n.accounts[accountID]; waiters != nil {
+		close(waiters.woken)
+		waiters.woken = make(chan struct{})
+	}
+}
+
+// NotifyAll wakes every waiter, e.g. after notifications may have been missed.
+func (n *EventNotifier) NotifyAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, waiters := range n.accounts {
+		close(waiters.woken)
+		waiters.woken = make(chan struct{})
+	}
+}
+
+// Run feeds the notifier from listen until ctx is done, listening again
+// after failures. Waiters are woken after each failure since notifications
+// may have been lost in between.
+func (n *EventNotifier) Run(ctx context.Context, listen func(ctx context.Context, notify func(uuid.UUID)) error) {
+	for {
+		err := listen(ctx, n.Notify)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("event listener failed: %v", err)
+		n.NotifyAll()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryWaiterSlots is a WaiterRepository shared by notifiers in one test,
+// standing in for Redis shared by server instances.
+type memoryWaiterSlots struct {
+	mu    sync.Mutex
+	slots map[uuid.UUID]map[uuid.UUID]bool
+}
+
+func newMemoryWaiterSlots() *memoryWaiterSlots {
+	return &memoryWaiterSlots{slots: make(map[uuid.UUID]map[uuid.UUID]bool)}
+}
+
+func (m *memoryWaiterSlots) Acquire(ctx context.Context, accountID, waiterID uuid.UUID, limit int, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.slots[accountID]) >= limit {
+		return false, nil
+	}
+	if m.slots[accountID] == nil {
+		m.slots[accountID] = make(map[uuid.UUID]bool)
+	}
+	m.slots[accountID][waiterID] = true
+	return true, nil
+}
+
+func (m *memoryWaiterSlots) Release(ctx context.Context, accountID, waiterID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.slots[accountID], waiterID)
+	return nil
+}
+
+// TestEventNotifier_WaiterLimit tests that the limit is per account and that releasing frees a place
+func TestEventNotifier_WaiterLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		notifiers func() (*EventNotifier, *EventNotifier)
+	}{
+		{
+			name: "one instance",
+			notifiers: func() (*EventNotifier, *EventNotifier) {
+				n := NewEventNotifier(2, nil)
+				return n, n
+			},
+		},
+		{
+			name: "instances sharing slots",
+			notifiers: func() (*EventNotifier, *EventNotifier) {
+				slots := newMemoryWaiterSlots()
+				return NewEventNotifier(2, slots), NewEventNotifier(2, slots)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := tt.notifiers()
+			ctx := context.Background()
+			accountID := uuid.New()
+
+			// ARRANGE: Fill the account's places across both notifiers
+			a, err := first.Subscribe(ctx, accountID)
+			require.NoError(t, err)
+			b, err := second.Subscribe(ctx, accountID)
+			require.NoError(t, err)
+			defer b.Release()
+
+			// ACT & ASSERT: One more is refused, on either notifier
+			_, err = first.Subscribe(ctx, accountID)
+			assert.ErrorIs(t, err, ErrTooManyWaiters)
+			_, err = second.Subscribe(ctx, accountID)
+			assert.ErrorIs(t, err, ErrTooManyWaiters)
+
+			// Other accounts and watchers aren't limited
+			other, err := first.Subscribe(ctx, uuid.New())
+			require.NoError(t, err)
+			other.Release()
+			watcher := first.Watch(accountID)
+			watcher.Release()
+
+			// Releasing, even twice, frees exactly one place
+			a.Release()
+			a.Release()
+			c, err := second.Subscribe(ctx, accountID)
+			require.NoError(t, err)
+			defer c.Release()
+			_, err = first.Subscribe(ctx, accountID)
+			assert.ErrorIs(t, err, ErrTooManyWaiters)
+		})
+	}
+}
+
+// failingWaiterSlots is a WaiterRepository that can't be reached, like Redis
+// while it is down.
+type failingWaiterSlots struct{}
+
+func (failingWaiterSlots) Acquire(ctx context.Context, accountID, waiterID uuid.UUID, limit int, ttl time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (failingWaiterSlots) Release(ctx context.Context, accountID, waiterID uuid.UUID) error {
+	return errors.New("connection refused")
+}
+
+// TestEventNotifier_WaiterLimitWithoutSlots tests that waiters are limited per instance while the shared slots are unreachable
+func TestEventNotifier_WaiterLimitWithoutSlots(t *testing.T) {
+	n := NewEventNotifier(1, failingWaiterSlots{})
+	ctx := context.Background()
+	accountID := uuid.New()
+
+	// ACT: Wait while the slots can't be reached
+	waiter, err := n.Subscribe(ctx, accountID)
+
+	// ASSERT: The waiter is let in, and counted against this instance's limit
+	require.NoError(t, err)
+	_, err = n.Subscribe(ctx, accountID)
+	assert.ErrorIs(t, err, ErrTooManyWaiters)
+
+	waiter.Release()
+	waiter, err = n.Subscribe(ctx, accountID)
+	require.NoError(t, err)
+	waiter.Release()
+}
+
+// TestEventNotifier_NotifyWakesWaiters tests that Notify wakes the account's waiters and NotifyAll wakes everyone
+func TestEventNotifier_NotifyWakesWaiters(t *testing.T) {
+	n := NewEventNotifier(0, nil)
+	ctx := context.Background()
+	accountID := uuid.New()
+	otherID := uuid.New()
+
+	waiter, err := n.Subscribe(ctx, accountID)
+	require.NoError(t, err)
+	defer waiter.Release()
+	watcher := n.Watch(accountID)
+	defer watcher.Release()
+	other, err := n.Subscribe(ctx, otherID)
+	require.NoError(t, err)
+	defer other.Release()
+
+	woken, watched, otherWoken := waiter.Woken(), watcher.Woken(), other.Woken()
+
+	// ACT: Notify one account
+	n.Notify(accountID)
+
+	// ASSERT: Its waiters wake, the other account's don't, and the next wait needs a new notification
+	assert.True(t, isClosed(woken))
+	assert.True(t, isClosed(watched))
+	assert.False(t, isClosed(otherWoken))
+	assert.False(t, isClosed(waiter.Woken()))
+
+	// NotifyAll reaches every account
+	woken = waiter.Woken()
+	n.NotifyAll()
+	assert.True(t, isClosed(woken))
+	assert.True(t, isClosed(otherWoken))
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
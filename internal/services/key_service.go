@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+const (
+	MaxKeyIDLength       = 255
+	MaxCipherSuiteLength = 64
+)
+
+var (
+	ErrInvalidKeyID    = errors.New("invalid encryption key ID")
+	ErrInvalidEnvelope = errors.New("invalid encryption envelope")
+)
+
+// KeyService tracks client encryption key rotation: which states are still
+// encrypted under a key ID, and which key IDs may no longer be written.
+type KeyService struct {
+	keyRepo   repositories.EncryptionKeyRepository
+	stateRepo repositories.EncryptedStateRepository
+}
+
+func NewKeyService(keyRepo repositories.EncryptionKeyRepository, stateRepo repositories.EncryptedStateRepository) *KeyService {
+	return &KeyService{keyRepo: keyRepo, stateRepo: stateRepo}
+}
+
+// StatesByKeyID lists metadata for the states visible to deviceID still
+// encrypted under keyID, i.e. what the device has left to re-encrypt before
+// the key can be dropped.
+func (s *KeyService) StatesByKeyID(ctx context.Context, accountID, deviceID uuid.UUID, keyID string) ([]*models.StateManifestEntry, error) {
+	if !validKeyID(keyID) {
+		return nil, ErrInvalidKeyID
+	}
+	return s.stateRepo.ListByKeyID(ctx, accountID, deviceID, keyID)
+}
+
+// Retire stops any further writes under keyID. States already encrypted under
+// it stay readable so clients can re-encrypt them.
+func (s *KeyService) Retire(ctx context.Context, accountID uuid.UUID, keyID string) (*models.RetiredKey, error) {
+	if !validKeyID(keyID) {
+		return nil, ErrInvalidKeyID
+	}
+	return s.keyRepo.Retire(ctx, accountID, keyID)
+}
+
+func (s *KeyService) ListRetired(ctx context.Context, accountID uuid.UUID) ([]*models.RetiredKey, error) {
+	return s.keyRepo.ListRetired(ctx, accountID)
+}
+
+// validateEnvelope checks the plaintext envelope of a state being written.
+// All fields are optional so clients that predate envelopes keep working.
+func validateEnvelope(envelope *models.EncryptionEnvelope) error {
+	if envelope.KeyID != "" && !validKeyID(envelope.KeyID) {
+		return ErrInvalidKeyID
+	}
+	if len(envelope.CipherSuite) > MaxCipherSuiteLength || !validKeyText(envelope.CipherSuite) {
+		return ErrInvalidEnvelope
+	}
+	if envelope.KeyGeneration < 0 || envelope.FormatVersion < 0 {
+		return ErrInvalidEnvelope
+	}
+	return nil
+}
+
+func validKeyID(keyID string) bool {
+	return keyID != "" && len(keyID) <= MaxKeyIDLength && validKeyText(keyID)
+}
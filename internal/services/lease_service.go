@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+const (
+	DefaultLeaseTTL = 30 * time.Second
+	MaxLeaseTTL     = 10 * time.Minute
+)
+
+var ErrInvalidLeaseTTL = errors.New("lease TTL must be between 1 second and 10 minutes")
+
+// LeaseService manages edit leases: a device editing a state takes a short
+// lease on its key and renews it while the editor is open, so other devices
+// can warn before editing concurrently. Leases don't require the state to
+// exist, so a new key can be claimed before its first write.
+type LeaseService struct {
+	leaseRepo repositories.LeaseRepository
+}
+
+func NewLeaseService(leaseRepo repositories.LeaseRepository) *LeaseService {
+	return &LeaseService{leaseRepo: leaseRepo}
+}
+
+// Acquire takes the lease on key for deviceID, or replaces the device's
+// existing lease. With enforce set, writes to the key from other devices are
+// rejected with repositories.ErrLeaseHeld until the lease ends. A ttl of 0
+// uses DefaultLeaseTTL.
+func (s *LeaseService) Acquire(ctx context.Context, accountID, deviceID uuid.UUID, key string, ttl time.Duration, enforce bool) (*models.Lease, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	ttl, err := leaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &models.Lease{AccountID: accountID, Key: key, DeviceID: deviceID, Enforced: enforce}
+	if err := s.leaseRepo.Acquire(ctx, lease, ttl); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Renew extends the device's lease on key to expire ttl from now.
+func (s *LeaseService) Renew(ctx context.Context, accountID, deviceID uuid.UUID, key string, ttl time.Duration) (*models.Lease, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	ttl, err := leaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	return s.leaseRepo.Renew(ctx, accountID, key, deviceID, ttl)
+}
+
+// Release ends the device's lease on key.
+func (s *LeaseService) Release(ctx context.Context, accountID, deviceID uuid.UUID, key string) error {
+	if err := validateStateKey(key); err != nil {
+		return err
+	}
+	return s.leaseRepo.Release(ctx, accountID, key, deviceID)
+}
+
+// Get returns the active lease on key, or repositories.ErrNotFound.
+func (s *LeaseService) Get(ctx context.Context, accountID uuid.UUID, key string) (*models.Lease, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	return s.leaseRepo.Get(ctx, accountID, key)
+}
+
+func leaseTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		return DefaultLeaseTTL, nil
+	}
+	if ttl < time.Second || ttl > MaxLeaseTTL {
+		return 0, ErrInvalidLeaseTTL
+	}
+	return ttl, nil
+}
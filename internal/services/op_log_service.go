@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+// MaxOpsPerAppend bounds how many ops one append may carry.
+const MaxOpsPerAppend = 1000
+
+var (
+	ErrInvalidOp       = errors.New("ops need a non-empty op and nonce")
+	ErrInvalidPosition = errors.New("position is past the end of the op log")
+)
+
+// OpLogPage is one page of a key's op log. When the requested position has
+// been compacted away, Snapshot is set and Ops continue from it; clients
+// replace their local state with the snapshot before applying Ops.
+// Position is the log's last position at the time of the read.
+type OpLogPage struct {
+	Snapshot *models.OpSnapshot `json:"snapshot,omitempty"`
+	Ops      []*models.StateOp  `json:"ops"`
+	Position int64              `json:"position"`
+	Next     int64              `json:"next"`
+	HasMore  bool               `json:"has_more"`
+}
+
+// OpLogService serves append-only encrypted op logs for CRDT clients. Unlike
+// states, appends never conflict; the server only orders the ops.
+type OpLogService struct {
+	opLogRepo repositories.OpLogRepository
+}
+
+func NewOpLogService(opLogRepo repositories.OpLogRepository) *OpLogService {
+	return &OpLogService{opLogRepo: opLogRepo}
+}
+
+// Append adds ops to the end of the key's log and sets their positions.
+func (s *OpLogService) Append(ctx context.Context, accountID, deviceID uuid.UUID, key string, ops []*models.StateOp) error {
+	if err := validateStateKey(key); err != nil {
+		return err
+	}
+	if len(ops) == 0 || len(ops) > MaxOpsPerAppend {
+		return ErrInvalidOp
+	}
+	for _, op := range ops {
+		if len(op.Op) == 0 || len(op.Nonce) == 0 {
+			return ErrInvalidOp
+		}
+		op.AccountID = accountID
+		op.DeviceID = deviceID
+		op.Key = key
+	}
+	return s.opLogRepo.Append(ctx, ops)
+}
+
+// Read returns the ops after position after, or the latest snapshot and the
+// ops following it if after predates the snapshot. A pageSize of 0 uses
+// DefaultPageSize. Pass Next as after to read the following page.
+func (s *OpLogService) Read(ctx context.Context, accountID uuid.UUID, key string, after int64, pageSize int) (*OpLogPage, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	// Positions are gapless, so a page that doesn't continue right after its
+	// starting point means a snapshot compacted those ops mid-read; retrying
+	// picks up the new snapshot.
+	for {
+		page, err := s.read(ctx, accountID, key, after, pageSize)
+		if !errors.Is(err, errCompactedDuringRead) {
+			return page, err
+		}
+	}
+}
+
+// errCompactedDuringRead tells Read to retry.
+var errCompactedDuringRead = errors.New("op log was compacted during read")
+
+func (s *OpLogService) read(ctx context.Context, accountID uuid.UUID, key string, after int64, pageSize int) (*OpLogPage, error) {
+	head, err := s.opLogRepo.GetHead(ctx, accountID, key)
+	if errors.Is(err, repositories.ErrNotFound) {
+		head = &models.OpLogHead{Key: key}
+	} else if err != nil {
+		return nil, err
+	}
+	if after < 0 || after > head.Position {
+		return nil, ErrInvalidPosition
+	}
+
+	page := &OpLogPage{Position: head.Position}
+	if after < head.SnapshotPosition {
+		page.Snapshot, err = s.opLogRepo.GetSnapshot(ctx, accountID, key)
+		if err != nil {
+			return nil, err
+		}
+		after = page.Snapshot.Position
+	}
+
+	ops, err := s.opLogRepo.ListAfter(ctx, accountID, key, after, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	if (len(ops) == 0 && after < head.Position) || (len(ops) > 0 && ops[0].Position != after+1) {
+		return nil, errCompactedDuringRead
+	}
+	if len(ops) > pageSize {
+		ops = ops[:pageSize]
+		page.HasMore = true
+	}
+
+	page.Ops = ops
+	page.Next = after
+	if len(ops) > 0 {
+		page.Next = ops[len(ops)-1].Position
+	}
+	return page, nil
+}
+
+// PublishSnapshot stores a compacted snapshot covering the ops up to
+// snapshot.Position, letting the server drop them.
+func (s *OpLogService) PublishSnapshot(ctx context.Context, snapshot *models.OpSnapshot) error {
+	if err := validateStateKey(snapshot.Key); err != nil {
+		return err
+	}
+	if len(snapshot.Snapshot) == 0 || len(snapshot.Nonce) == 0 {
+		return ErrInvalidOp
+	}
+	if snapshot.Position <= 0 {
+		return ErrInvalidPosition
+	}
+	return s.opLogRepo.PublishSnapshot(ctx, snapshot)
+}
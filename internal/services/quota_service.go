@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+type QuotaService struct {
+	quotaRepo repositories.QuotaRepository
+}
+
+type UsageReport struct {
+	Usage  *models.AccountUsage `json:"usage"`
+	Limits *models.QuotaLimits  `json:"limits"`
+}
+
+func NewQuotaService(quotaRepo repositories.QuotaRepository) *QuotaService {
+	return &QuotaService{quotaRepo: quotaRepo}
+}
+
+// GetUsage reports an account's current usage alongside its effective limits.
+func (s *QuotaService) GetUsage(ctx context.Context, accountID uuid.UUID) (*UsageReport, error) {
+	usage, err := s.quotaRepo.GetUsage(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	limits, err := s.quotaRepo.GetLimits(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get limits: %w", err)
+	}
+
+	return &UsageReport{Usage: usage, Limits: limits}, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+var ErrInvalidShare = errors.New("invalid share")
+
+// SharedState is a state read through a share, with the grantee's wrapped
+// content key needed to decrypt it.
+type SharedState struct {
+	State *models.EncryptedState `json:"state"`
+	Share *models.StateShare     `json:"share"`
+}
+
+// ShareService manages grants that give other accounts access to individual
+// states. Reads and writes through a grant go through StateService.GetAs and
+// SyncService.PutAs; this service covers the grants themselves and the
+// chunks of shared states.
+type ShareService struct {
+	shareRepo   repositories.ShareRepository
+	stateRepo   repositories.EncryptedStateRepository
+	accountRepo repositories.AccountRepository
+	chunkRepo   repositories.ChunkRepository
+}
+
+func NewShareService(
+	shareRepo repositories.ShareRepository,
+	stateRepo repositories.EncryptedStateRepository,
+	accountRepo repositories.AccountRepository,
+	chunkRepo repositories.ChunkRepository,
+) *ShareService {
+	return &ShareService{
+		shareRepo:   shareRepo,
+		stateRepo:   stateRepo,
+		accountRepo: accountRepo,
+		chunkRepo:   chunkRepo,
+	}
+}
+
+// Grant shares the owner's state at key with share.GranteeAccountID, or
+// updates an existing grant. The grantee is notified through their event stream.
+func (s *ShareService) Grant(ctx context.Context, ownerID uuid.UUID, key string, share *models.StateShare) error {
+	if err := validateStateKey(key); err != nil {
+		return err
+	}
+	if share.GranteeAccountID == ownerID {
+		return fmt.Errorf("%w: cannot share with yourself", ErrInvalidShare)
+	}
+	if share.Permission != models.SharePermissionRead && share.Permission != models.SharePermissionReadWrite {
+		return fmt.Errorf("%w: permission must be %q or %q", ErrInvalidShare, models.SharePermissionRead, models.SharePermissionReadWrite)
+	}
+	if len(share.WrappedKey) == 0 {
+		return fmt.Errorf("%w: wrapped_key is required", ErrInvalidShare)
+	}
+	if share.ExpiresAt != nil && !share.ExpiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+
+	if _, err := s.accountRepo.GetByID(ctx, share.GranteeAccountID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return fmt.Errorf("%w: unknown grantee account", ErrInvalidShare)
+		}
+		return fmt.Errorf("failed to get grantee: %w", err)
+	}
+
+	state, err := s.stateRepo.GetByKey(ctx, ownerID, key)
+	if err != nil {
+		return err
+	}
+
+	share.StateID = state.ID
+	share.OwnerAccountID = ownerID
+	return s.shareRepo.Grant(ctx, share)
+}
+
+// Revoke removes the grant on the owner's state at key to granteeID.
+func (s *ShareService) Revoke(ctx context.Context, ownerID uuid.UUID, key string, granteeID uuid.UUID) error {
+	if err := validateStateKey(key); err != nil {
+		return err
+	}
+	state, err := s.stateRepo.GetByKey(ctx, ownerID, key)
+	if err != nil {
+		return err
+	}
+	return s.shareRepo.Revoke(ctx, ownerID, state.ID, granteeID)
+}
+
+// ListGrants returns every grant on the owner's state at key.
+func (s *ShareService) ListGrants(ctx context.Context, ownerID uuid.UUID, key string) ([]*models.StateShare, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	state, err := s.stateRepo.GetByKey(ctx, ownerID, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.shareRepo.ListByState(ctx, state.ID)
+}
+
+// SharedWithMe returns the active shares other accounts have granted to granteeID.
+func (s *ShareService) SharedWithMe(ctx context.Context, granteeID uuid.UUID) ([]*models.StateShare, error) {
+	return s.shareRepo.ListByGrantee(ctx, granteeID)
+}
+
+// GetShared reads another account's state through the grantee's share.
+func (s *ShareService) GetShared(ctx context.Context, granteeID, ownerID uuid.UUID, key string) (*SharedState, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	state, err := s.stateRepo.GetByKeyAs(ctx, granteeID, ownerID, key)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.shareRepo.Get(ctx, state.ID, granteeID)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedState{State: state, Share: share}, nil
+}
+
+// GetSharedChunk returns a chunk of a state ownerID has shared with granteeID.
+func (s *ShareService) GetSharedChunk(ctx context.Context, granteeID, ownerID uuid.UUID, hash string) (*models.Chunk, error) {
+	if !validChunkHash(hash) {
+		return nil, ErrInvalidChunkHash
+	}
+	ok, err := s.shareRepo.HasChunkAccess(ctx, ownerID, granteeID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	return s.chunkRepo.Get(ctx, ownerID, hash)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+const (
+	MaxStateKeyLength = 255
+	MaxChunksPerState = 10000
+
+	// MaxVisibleDevices bounds the device scope of a state.
+	MaxVisibleDevices = 100
+
+	// KeySeparator splits hierarchical keys into namespaces, e.g. "notes/2026/todo".
+	KeySeparator = "/"
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+var (
+	ErrInvalidStateKey = errors.New("invalid state key")
+	ErrInvalidPrefix   = errors.New("invalid key prefix")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrUndeleteExpired = errors.New("state was deleted too long ago to undelete")
+	ErrInvalidExpiry   = errors.New("expires_at must be in the future")
+	ErrTooManyChunks   = errors.New("state references too many chunks")
+	ErrMissingChunks   = errors.New("state references chunks that have not been uploaded")
+	ErrSharedChunks    = errors.New("shared states can only be written inline, without chunks")
+)
+
+// StatePage is one page of a prefix listing. NextCursor is empty on the last page.
+type StatePage struct {
+	States     []*models.EncryptedState `json:"states"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// StateService is the entry point for reading encrypted states and runs the
+// background jobs that maintain them. Writes go through SyncService.
+type StateService struct {
+	stateRepo          repositories.EncryptedStateRepository
+	tombstoneRetention time.Duration
+}
+
+// NewStateService creates a StateService. The content of deleted states is
+// purged once they are older than tombstoneRetention.
+func NewStateService(stateRepo repositories.EncryptedStateRepository, tombstoneRetention time.Duration) *StateService {
+	return &StateService{
+		stateRepo:          stateRepo,
+		tombstoneRetention: tombstoneRetention,
+	}
+}
+
+// Get returns the state at key as deviceID sees it: states scoped to other
+// devices are reported as repositories.ErrNotFound.
+func (s *StateService) Get(ctx context.Context, accountID, deviceID uuid.UUID, key string) (*models.EncryptedState, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	state, err := s.stateRepo.GetByKey(ctx, accountID, key)
+	if err != nil {
+		return nil, err
+	}
+	if !state.VisibleToDevice(deviceID) {
+		return nil, repositories.ErrNotFound
+	}
+	return state, nil
+}
+
+// GetAs reads ownerID's state on behalf of actorID, who must own it or hold
+// an active share on it.
+func (s *StateService) GetAs(ctx context.Context, actorID, ownerID uuid.UUID, key string) (*models.EncryptedState, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	return s.stateRepo.GetByKeyAs(ctx, actorID, ownerID, key)
+}
+
+// List returns the page of states visible to deviceID whose key starts with
+// prefix that follows cursor. An empty prefix lists every key, an empty
+// cursor starts from the first key, and a pageSize of 0 uses DefaultPageSize.
+func (s *StateService) List(ctx context.Context, accountID, deviceID uuid.UUID, prefix, cursor string, pageSize int) (*StatePage, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if after != "" && !strings.HasPrefix(after, prefix) {
+		return nil, ErrInvalidCursor
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	states, err := s.stateRepo.ListByPrefix(ctx, accountID, deviceID, prefix, after, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &StatePage{States: states}
+	if len(states) > pageSize {
+		page.States = states[:pageSize]
+		page.NextCursor = encodeCursor(page.States[pageSize-1].Key)
+	}
+	if page.States == nil {
+		page.States = []*models.EncryptedState{}
+	}
+	return page, nil
+}
+
+// Manifest returns key, version, size, content hash, update time and last
+// writer for every state under prefix visible to deviceID, without any
+// ciphertext.
+func (s *StateService) Manifest(ctx context.Context, accountID, deviceID uuid.UUID, prefix string) ([]*models.StateManifestEntry, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return s.stateRepo.GetManifest(ctx, accountID, deviceID, prefix)
+}
+
+// PurgeTombstones drops the content of states deleted longer ago than the
+// retention window.
+func (s *StateService) PurgeTombstones(ctx context.Context) (int64, error) {
+	return s.stateRepo.PurgeTombstones(ctx, time.Now().Add(-s.tombstoneRetention))
+}
+
+// RunTombstonePurger calls PurgeTombstones every interval until ctx is done.
+func (s *StateService) RunTombstonePurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeTombstones(ctx)
+			if err != nil {
+				log.Printf("tombstone purge failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("tombstone purge removed content of %d states", purged)
+			}
+		}
+	}
+}
+
+// validateStateKey checks that key is a well-formed hierarchical key:
+// non-empty segments separated by KeySeparator, without control characters.
+func validateStateKey(key string) error {
+	if key == "" || !validKeyText(key) {
+		return ErrInvalidStateKey
+	}
+	for _, segment := range strings.Split(key, KeySeparator) {
+		if segment == "" {
+			return ErrInvalidStateKey
+		}
+	}
+	return nil
+}
+
+// normalizeVisibility dedupes and sorts a state's device scope, treating an
+// empty list as account-wide.
+func normalizeVisibility(state *models.EncryptedState) error {
+	if len(state.VisibleTo) == 0 {
+		state.VisibleTo = nil
+		return nil
+	}
+	if len(state.VisibleTo) > MaxVisibleDevices {
+		return fmt.Errorf("%w: at most %d devices", repositories.ErrInvalidVisibility, MaxVisibleDevices)
+	}
+	slices.SortFunc(state.VisibleTo, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	state.VisibleTo = slices.Compact(state.VisibleTo)
+	return nil
+}
+
+// validatePrefix checks a listing prefix. Prefixes follow the key rules but
+// may be empty, end in KeySeparator, or stop part-way through a segment.
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if !validKeyText(prefix) || strings.HasPrefix(prefix, KeySeparator) ||
+		strings.Contains(prefix, KeySeparator+KeySeparator) {
+		return ErrInvalidPrefix
+	}
+	return nil
+}
+
+func validKeyText(s string) bool {
+	if len(s) > MaxStateKeyLength || !utf8.ValidString(s) {
+		return false
+	}
+	return !strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// Cursors are opaque to clients; they carry the last key of the previous page.
+func encodeCursor(lastKey string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	lastKey, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !validKeyText(string(lastKey)) {
+		return "", ErrInvalidCursor
+	}
+	return string(lastKey), nil
+}
@@ -0,0 +1,576 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prudhvinik1/edgesync/internal/models"
+	"github.com/prudhvinik1/edgesync/internal/repositories"
+)
+
+const (
+	// MaxEventFilters bounds the prefixes, and the event types, of one filter.
+	MaxEventFilters = 20
+
+	// MaxEventWait bounds how long a request may wait for new events.
+	MaxEventWait = 60 * time.Second
+)
+
+var (
+	ErrInvalidSequence = errors.New("sequence number must not be negative")
+	ErrInvalidFilter   = errors.New("invalid event filter")
+)
+
+// eventTypes are the event types a filter may name.
+var eventTypes = []string{
+	models.EventTypeCreate,
+	models.EventTypeUpdate,
+	models.EventTypeDelete,
+	models.EventTypeShare,
+	models.EventTypeUnshare,
+	models.EventTypeOps,
+}
+
+// SyncService is the write path for encrypted states. Every change it makes
+// is committed together with the sync event that announces it to the
+// account's other devices (create, update or delete, with the state's key
+// and new version), so a change can't be stored without being delivered.
+// Devices catch up on those events through Events. State reads go through
+// StateService.
+type SyncService struct {
+	txs                repositories.Transactor
+	stateRepo          repositories.EncryptedStateRepository
+	chunkRepo          repositories.ChunkRepository
+	eventRepo          repositories.SyncEventRepository
+	deviceRepo         repositories.DeviceRepository
+	notifier           *EventNotifier
+	tombstoneRetention time.Duration
+}
+
+// NewSyncService creates a SyncService. Deleted states can be undeleted for
+// tombstoneRetention. Requests waiting for new events are woken by notifier.
+// State writes and their events share transactions begun with txs.
+func NewSyncService(
+	txs repositories.Transactor,
+	stateRepo repositories.EncryptedStateRepository,
+	chunkRepo repositories.ChunkRepository,
+	eventRepo repositories.SyncEventRepository,
+	deviceRepo repositories.DeviceRepository,
+	notifier *EventNotifier,
+	tombstoneRetention time.Duration,
+) *SyncService {
+	return &SyncService{
+		txs:                txs,
+		stateRepo:          stateRepo,
+		chunkRepo:          chunkRepo,
+		eventRepo:          eventRepo,
+		deviceRepo:         deviceRepo,
+		notifier:           notifier,
+		tombstoneRetention: tombstoneRetention,
+	}
+}
+
+const (
+	// compactBatchSize bounds how many accounts one compaction statement handles.
+	compactBatchSize = 100
+
+	// eventPartitionsAhead is how many months of event partitions are kept
+	// ready beyond the current one.
+	eventPartitionsAhead = 3
+
+	// reapBatchSize bounds how many expired states one reaper transaction
+	// handles, and how many accounts each pass of the reaper lists.
+	reapBatchSize = 500
+)
+
+// EventPage is one page of an account's event stream. Pass Next as since to
+// read the following page; HasMore reports whether one is already waiting.
+// ResyncRequired means the events after since have been compacted away: the
+// device must rebuild its state from the current states (a snapshot) and
+// continue from Next, the compaction horizon.
+type EventPage struct {
+	Events         []*models.SyncEvent `json:"events"`
+	Next           int64               `json:"next"`
+	HasMore        bool                `json:"has_more"`
+	ResyncRequired bool                `json:"resync_required,omitempty"`
+}
+
+// Events returns the events deviceID may receive with sequence numbers after
+// since that match filter, oldest first. A pageSize of 0 uses
+// DefaultPageSize; larger pages are capped at MaxPageSize.
+func (s *SyncService) Events(ctx context.Context, accountID, deviceID uuid.UUID, since int64, filter models.EventFilter, pageSize int) (*EventPage, error) {
+	if since < 0 {
+		return nil, ErrInvalidSequence
+	}
+	if err := validateEventFilter(filter); err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	// Fetch one extra event to learn whether another page follows
+	events, err := s.eventRepo.GetSinceSequence(ctx, accountID, deviceID, since, filter, pageSize+1)
+	if errors.Is(err, repositories.ErrResyncRequired) {
+		// The horizon may have moved on since the read; the latest one is
+		// just as good a place to continue from after the snapshot
+		horizon, err := s.eventRepo.GetHorizon(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+		return &EventPage{Events: []*models.SyncEvent{}, Next: horizon, ResyncRequired: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &EventPage{Events: events, Next: since}
+	if len(events) > pageSize {
+		page.Events = events[:pageSize]
+		page.HasMore = true
+	}
+	if len(page.Events) > 0 {
+		page.Next = page.Events[len(page.Events)-1].SequenceNumber
+	}
+	if page.Events == nil {
+		page.Events = []*models.SyncEvent{}
+	}
+	return page, nil
+}
+
+// WaitEvents is Events, except that when no events follow since it waits up
+// to wait (at most MaxEventWait) for some to be appended, returning an empty
+// page if none arrive in time. Only a limited number of requests per account
+// may wait at once; beyond that it returns ErrTooManyWaiters.
+func (s *SyncService) WaitEvents(ctx context.Context, accountID, deviceID uuid.UUID, since int64, filter models.EventFilter, pageSize int, wait time.Duration) (*EventPage, error) {
+	if wait <= 0 {
+		return s.Events(ctx, accountID, deviceID, since, filter, pageSize)
+	}
+	if wait > MaxEventWait {
+		wait = MaxEventWait
+	}
+
+	waiter, err := s.notifier.Subscribe(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer waiter.Release()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		// Take the wakeup channel before reading, so an event appended
+		// after the read still wakes us
+		woken := waiter.Woken()
+
+		page, err := s.Events(ctx, accountID, deviceID, since, filter, pageSize)
+		if err != nil || len(page.Events) > 0 || page.ResyncRequired {
+			return page, err
+		}
+
+		// Wakeups are per account: the new events may be ones this device
+		// can't see or the filter excludes, so read again before returning
+		select {
+		case <-woken:
+		case <-timer.C:
+			return page, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Watch registers for wakeups whenever events are appended to the account,
+// for connections that stream events as they arrive. Take the waiter's
+// Woken channel before each read of Events. The waiter must be released
+// when the connection ends.
+func (s *SyncService) Watch(accountID uuid.UUID) *EventWaiter {
+	return s.notifier.Watch(accountID)
+}
+
+// CompactEvents compacts the event log of every account: events created more
+// than olderThan ago are reduced to the latest event per state key. It
+// returns how many events were dropped.
+func (s *SyncService) CompactEvents(ctx context.Context, olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var total int64
+	for {
+		accounts, dropped, err := s.eventRepo.Compact(ctx, cutoff, compactBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += dropped
+		if accounts < compactBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// RunEventCompactor calls CompactEvents every interval until ctx is done.
+func (s *SyncService) RunEventCompactor(ctx context.Context, interval, olderThan time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dropped, err := s.CompactEvents(ctx, olderThan)
+			if err != nil {
+				log.Printf("event compaction failed: %v", err)
+				continue
+			}
+			if dropped > 0 {
+				log.Printf("event compaction dropped %d superseded events", dropped)
+			}
+		}
+	}
+}
+
+// MaintainEventPartitions creates the event partitions for the coming months
+// and, if retention is positive, drops partitions holding only events older
+// than retention. Devices that hadn't synced the dropped events are told to
+// resync.
+func (s *SyncService) MaintainEventPartitions(ctx context.Context, retention time.Duration) error {
+	now := time.Now()
+	created, err := s.eventRepo.EnsurePartitions(ctx, now, eventPartitionsAhead)
+	if err != nil {
+		return err
+	}
+	if created > 0 {
+		log.Printf("event partitions: created %d", created)
+	}
+
+	if retention <= 0 {
+		return nil
+	}
+	dropped, err := s.eventRepo.DropPartitionsBefore(ctx, now.Add(-retention))
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		log.Printf("event partitions: dropped %d past retention", dropped)
+	}
+	return nil
+}
+
+// RunPartitionMaintainer calls MaintainEventPartitions every interval until ctx is done.
+func (s *SyncService) RunPartitionMaintainer(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.MaintainEventPartitions(ctx, retention); err != nil {
+				log.Printf("event partition maintenance failed: %v", err)
+			}
+		}
+	}
+}
+
+// Ack moves deviceID's sync cursor up to sequenceNumber once the device has
+// applied every event up to it. The cursor never moves back, so acks may
+// arrive out of order.
+func (s *SyncService) Ack(ctx context.Context, accountID, deviceID uuid.UUID, sequenceNumber int64) error {
+	if sequenceNumber < 0 {
+		return ErrInvalidSequence
+	}
+	return s.deviceRepo.AckSequence(ctx, accountID, deviceID, sequenceNumber)
+}
+
+// Put writes a state with optimistic locking (see EncryptedStateRepository.Upsert).
+// A state with ExpiresAt set disappears from reads once that time passes and
+// is later tombstoned by the expiry reaper.
+// A state with Chunks set is a chunked state: its payload lives in the chunk
+// store, every listed chunk must already be uploaded, and State is stored empty.
+// Writes under a key ID the account has retired fail with repositories.ErrKeyRetired.
+// A state with VisibleTo set is only readable by, and only delivered to, the
+// listed devices of the account; an empty list means account-wide.
+func (s *SyncService) Put(ctx context.Context, state *models.EncryptedState) error {
+	return s.PutAs(ctx, state.AccountID, state)
+}
+
+// PutAs is Put on behalf of actorID, who must own the state or hold an
+// active read-write share on it. Grantees can only write inline states, as
+// chunks live in the owner's chunk store.
+func (s *SyncService) PutAs(ctx context.Context, actorID uuid.UUID, state *models.EncryptedState) error {
+	if err := validateStateKey(state.Key); err != nil {
+		return err
+	}
+	if state.ExpiresAt != nil && !state.ExpiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	if err := validateEnvelope(&state.EncryptionEnvelope); err != nil {
+		return err
+	}
+	if err := normalizeVisibility(state); err != nil {
+		return err
+	}
+	if state.VisibleTo != nil && actorID != state.AccountID {
+		return fmt.Errorf("%w: grantees can't scope states to devices", repositories.ErrInvalidVisibility)
+	}
+
+	if len(state.Chunks) > 0 {
+		if actorID != state.AccountID {
+			return ErrSharedChunks
+		}
+		if len(state.Chunks) > MaxChunksPerState {
+			return ErrTooManyChunks
+		}
+		for _, hash := range state.Chunks {
+			if !validChunkHash(hash) {
+				return ErrInvalidChunkHash
+			}
+		}
+
+		missing, err := s.chunkRepo.Missing(ctx, state.AccountID, state.Chunks)
+		if err != nil {
+			return fmt.Errorf("failed to check chunks: %w", err)
+		}
+		if len(missing) > 0 {
+			return ErrMissingChunks
+		}
+
+		// The state column is NOT NULL; an empty slice (not nil) stores ''.
+		state.State = []byte{}
+	} else {
+		state.Chunks = nil
+	}
+
+	tx, err := s.txs.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	eventType, err := s.stateRepo.UpsertTx(ctx, tx, actorID, state)
+	if err != nil {
+		return err
+	}
+	if err := s.eventRepo.AppendStateEventTx(ctx, tx, state.ID, stateEvent(state, eventType)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit state: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a state if expectedVersion is still its current version,
+// leaving a tombstone at the next version and a delete event.
+func (s *SyncService) Delete(ctx context.Context, accountID, deviceID uuid.UUID, key string, expectedVersion int64) (*models.EncryptedState, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+	state, err := s.stateRepo.GetByKey(ctx, accountID, key)
+	if err != nil {
+		return nil, err
+	}
+	if !state.VisibleToDevice(deviceID) {
+		return nil, repositories.ErrNotFound
+	}
+
+	state.DeviceID = deviceID
+	state.Version = expectedVersion
+
+	tx, err := s.txs.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.stateRepo.DeleteTx(ctx, tx, state); err != nil {
+		return nil, err
+	}
+	if err := s.eventRepo.AppendStateEventTx(ctx, tx, state.ID, stateEvent(state, models.EventTypeDelete)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit delete: %w", err)
+	}
+	return state, nil
+}
+
+// Undelete restores the content a state had when it was deleted, provided
+// the deletion is within the retention window and expectedVersion is the
+// tombstone's version. The restored state gets the next version.
+func (s *SyncService) Undelete(ctx context.Context, accountID, deviceID uuid.UUID, key string, expectedVersion int64) (*models.EncryptedState, error) {
+	if err := validateStateKey(key); err != nil {
+		return nil, err
+	}
+
+	tombstone, err := s.stateRepo.GetTombstone(ctx, accountID, key)
+	if err != nil {
+		return nil, err
+	}
+	if !tombstone.VisibleToDevice(deviceID) {
+		return nil, repositories.ErrNotFound
+	}
+	if time.Since(*tombstone.DeletedAt) > s.tombstoneRetention {
+		return nil, ErrUndeleteExpired
+	}
+
+	tombstone.DeviceID = deviceID
+	tombstone.Version = expectedVersion
+
+	tx, err := s.txs.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The restore is announced as a create
+	if err := s.stateRepo.UndeleteTx(ctx, tx, tombstone); err != nil {
+		return nil, err
+	}
+	if err := s.eventRepo.AppendStateEventTx(ctx, tx, tombstone.ID, stateEvent(tombstone, models.EventTypeCreate)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit undelete: %w", err)
+	}
+	return tombstone, nil
+}
+
+// ReapExpired tombstones every state whose expiry has passed, emitting a
+// delete sync event for each. It returns how many states were reaped.
+func (s *SyncService) ReapExpired(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		accountIDs, err := s.stateRepo.ExpiredAccountIDs(ctx, reapBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		pass := 0
+		for _, accountID := range accountIDs {
+			reaped, err := s.reapAccount(ctx, accountID)
+			total += reaped
+			pass += reaped
+			if err != nil {
+				return total, err
+			}
+		}
+
+		// Stop once every account is done, or the rest are being reaped by
+		// another instance
+		if len(accountIDs) < reapBatchSize || pass == 0 {
+			return total, nil
+		}
+	}
+}
+
+// reapAccount reaps the account's expired states, reapBatchSize per
+// transaction. Each transaction only touches the one account, so it takes
+// its locks in the same order as the account's own writes.
+func (s *SyncService) reapAccount(ctx context.Context, accountID uuid.UUID) (int, error) {
+	total := 0
+	for {
+		reaped, err := s.reapBatch(ctx, accountID)
+		if err != nil {
+			return total, err
+		}
+		total += reaped
+		if reaped < reapBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// reapBatch reaps up to reapBatchSize of the account's expired states in one
+// transaction.
+func (s *SyncService) reapBatch(ctx context.Context, accountID uuid.UUID) (int, error) {
+	tx, err := s.txs.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	reaped, err := s.stateRepo.ReapExpiredTx(ctx, tx, accountID, reapBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, state := range reaped {
+		// The server reaps, not a device
+		event := stateEvent(state, models.EventTypeDelete)
+		event.DeviceID = uuid.Nil
+		if err := s.eventRepo.AppendStateEventTx(ctx, tx, state.ID, event); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit reaped states: %w", err)
+	}
+	return len(reaped), nil
+}
+
+// RunExpiryReaper calls ReapExpired every interval until ctx is done.
+func (s *SyncService) RunExpiryReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reaped, err := s.ReapExpired(ctx)
+			if err != nil {
+				log.Printf("expiry reaper failed: %v", err)
+				continue
+			}
+			if reaped > 0 {
+				log.Printf("expiry reaper deleted %d expired states", reaped)
+			}
+		}
+	}
+}
+
+// stateEvent is the owner's sync event announcing that state.DeviceID moved
+// state to its current version. It reaches the same devices as the state.
+func stateEvent(state *models.EncryptedState, eventType string) *models.SyncEvent {
+	return &models.SyncEvent{
+		AccountID:    state.AccountID,
+		DeviceID:     state.DeviceID,
+		EventType:    eventType,
+		StateKey:     state.Key,
+		StateVersion: state.Version,
+		VisibleTo:    state.VisibleTo,
+	}
+}
+
+// validateEventFilter checks that a filter's prefixes are valid, non-empty
+// key prefixes and its event types are known.
+func validateEventFilter(filter models.EventFilter) error {
+	if len(filter.Prefixes) > MaxEventFilters || len(filter.EventTypes) > MaxEventFilters {
+		return fmt.Errorf("%w: at most %d prefixes and %d event types", ErrInvalidFilter, MaxEventFilters, MaxEventFilters)
+	}
+	for _, prefix := range filter.Prefixes {
+		if prefix == "" || validatePrefix(prefix) != nil {
+			return fmt.Errorf("%w: bad prefix %q", ErrInvalidFilter, prefix)
+		}
+	}
+	for _, eventType := range filter.EventTypes {
+		if !slices.Contains(eventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidFilter, eventType)
+		}
+	}
+	return nil
+}
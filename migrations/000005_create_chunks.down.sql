@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_encrypted_states_chunks;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS chunks;
+DROP TABLE IF EXISTS chunks;
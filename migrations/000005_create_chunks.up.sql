@@ -0,0 +1,15 @@
+CREATE TABLE chunks (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    hash TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    touched_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (account_id, hash)
+);
+
+CREATE INDEX idx_chunks_touched_at ON chunks(touched_at);
+
+ALTER TABLE encrypted_states ADD COLUMN chunks TEXT[];
+
+CREATE INDEX idx_encrypted_states_chunks ON encrypted_states USING GIN (chunks);
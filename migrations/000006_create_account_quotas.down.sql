@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_usage;
+DROP TABLE IF EXISTS account_quotas;
@@ -0,0 +1,27 @@
+CREATE TABLE account_quotas (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    max_bytes BIGINT,
+    max_keys BIGINT,
+    max_blob_size BIGINT,
+    max_events_per_day BIGINT,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE account_usage (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    bytes_used BIGINT NOT NULL DEFAULT 0,
+    key_count BIGINT NOT NULL DEFAULT 0,
+    events_today BIGINT NOT NULL DEFAULT 0,
+    events_day DATE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')::date,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Backfill usage for accounts that already have data
+INSERT INTO account_usage (account_id, bytes_used, key_count)
+SELECT a.id,
+       COALESCE((SELECT SUM(octet_length(s.state) + octet_length(s.nonce))
+                 FROM encrypted_states s
+                 WHERE s.account_id = a.id AND s.deleted_at IS NULL), 0)
+     + COALESCE((SELECT SUM(c.size) FROM chunks c WHERE c.account_id = a.id), 0),
+       (SELECT COUNT(*) FROM encrypted_states s WHERE s.account_id = a.id AND s.deleted_at IS NULL)
+FROM accounts a;
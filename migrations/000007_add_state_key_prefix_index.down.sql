@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_encrypted_states_account_key_prefix;
@@ -0,0 +1,5 @@
+-- Prefix listing compares keys bytewise (COLLATE "C") so that every key
+-- starting with a prefix sorts directly after it, whatever the database locale.
+CREATE INDEX idx_encrypted_states_account_key_prefix
+    ON encrypted_states (account_id, key COLLATE "C")
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS size;
@@ -0,0 +1,12 @@
+-- size is the logical ciphertext size (inline state + nonce, or the sum of
+-- chunk sizes + nonce for chunked states). content_hash is the hex SHA-256 of
+-- state || nonce || the chunk hashes in order.
+ALTER TABLE encrypted_states ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE encrypted_states ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+UPDATE encrypted_states s
+SET size = octet_length(s.state) + octet_length(s.nonce)
+         + COALESCE((SELECT SUM(c.size)
+                     FROM unnest(s.chunks) AS h(hash)
+                     JOIN chunks c ON c.account_id = s.account_id AND c.hash = h.hash), 0),
+    content_hash = encode(sha256(s.state || s.nonce || convert_to(COALESCE(array_to_string(s.chunks, ''), ''), 'UTF8')), 'hex');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_encrypted_states_tombstones;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS purged_at;
@@ -0,0 +1,8 @@
+-- Deleted states are kept as tombstones: the row (and its version) stays so a
+-- recreated key continues the version sequence, and its content stays until
+-- purged_at is set so it can be undeleted within the retention window.
+ALTER TABLE encrypted_states ADD COLUMN purged_at TIMESTAMPTZ;
+
+CREATE INDEX idx_encrypted_states_tombstones
+    ON encrypted_states (deleted_at)
+    WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE sync_events DROP COLUMN IF EXISTS state_version;
+DROP INDEX IF EXISTS idx_encrypted_states_expires_at;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,8 @@
+ALTER TABLE encrypted_states ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX idx_encrypted_states_expires_at
+    ON encrypted_states (expires_at)
+    WHERE expires_at IS NOT NULL AND deleted_at IS NULL;
+
+-- Version of the state an event refers to (NULL for events not about a state)
+ALTER TABLE sync_events ADD COLUMN state_version BIGINT;
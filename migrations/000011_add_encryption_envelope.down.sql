@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS retired_keys;
+DROP INDEX IF EXISTS idx_encrypted_states_key_id;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS format_version;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS key_generation;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS key_id;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS cipher_suite;
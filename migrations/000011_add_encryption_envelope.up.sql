@@ -0,0 +1,17 @@
+-- Plaintext envelope describing how the client encrypted each state. The
+-- server never decrypts; it uses these to track key rotation.
+ALTER TABLE encrypted_states ADD COLUMN cipher_suite VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE encrypted_states ADD COLUMN key_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE encrypted_states ADD COLUMN key_generation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE encrypted_states ADD COLUMN format_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_encrypted_states_key_id
+    ON encrypted_states (account_id, key_id)
+    WHERE deleted_at IS NULL;
+
+CREATE TABLE retired_keys (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    key_id VARCHAR(255) NOT NULL,
+    retired_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (account_id, key_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE sync_events DROP COLUMN IF EXISTS owner_account_id;
+DROP TABLE IF EXISTS state_shares;
@@ -0,0 +1,19 @@
+CREATE TABLE state_shares (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_id UUID NOT NULL REFERENCES encrypted_states(id) ON DELETE CASCADE,
+    owner_account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    grantee_account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    permission VARCHAR(16) NOT NULL CHECK (permission IN ('read', 'read_write')),
+    -- The state's content key, wrapped by the owner for the grantee
+    wrapped_key BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (state_id, grantee_account_id),
+    CHECK (owner_account_id <> grantee_account_id)
+);
+
+CREATE INDEX idx_state_shares_grantee ON state_shares (grantee_account_id);
+
+-- Events about another account's shared state name that account as owner
+ALTER TABLE sync_events ADD COLUMN owner_account_id UUID REFERENCES accounts(id) ON DELETE CASCADE;
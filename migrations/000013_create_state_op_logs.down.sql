@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS state_ops;
+DROP TABLE IF EXISTS op_log_heads;
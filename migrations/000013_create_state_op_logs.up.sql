@@ -0,0 +1,28 @@
+-- Append-only encrypted operation logs, one per (account, key), for CRDT
+-- clients. op_log_heads assigns positions and holds the latest compacted
+-- snapshot; ops at or before the snapshot position are dropped.
+CREATE TABLE op_log_heads (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    position BIGINT NOT NULL DEFAULT 0,
+    snapshot_position BIGINT NOT NULL DEFAULT 0,
+    snapshot BYTEA,
+    snapshot_nonce BYTEA,
+    snapshot_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    snapshot_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (account_id, key)
+);
+
+CREATE TABLE state_ops (
+    account_id UUID NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    position BIGINT NOT NULL,
+    device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    op BYTEA NOT NULL,
+    nonce BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (account_id, key, position),
+    FOREIGN KEY (account_id, key) REFERENCES op_log_heads(account_id, key) ON DELETE CASCADE
+);
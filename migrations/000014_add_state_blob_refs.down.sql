@@ -0,0 +1,4 @@
+-- Offloaded states must be inlined again before rolling back, or their
+-- ciphertext is lost
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS blob_size;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS blob_key;
@@ -0,0 +1,5 @@
+-- Ciphertext above the offload threshold lives in the blob store. Such rows
+-- keep an empty state; blob_key names the blob and blob_size is its length,
+-- which still counts against the storage quota.
+ALTER TABLE encrypted_states ADD COLUMN blob_key TEXT;
+ALTER TABLE encrypted_states ADD COLUMN blob_size BIGINT NOT NULL DEFAULT 0;
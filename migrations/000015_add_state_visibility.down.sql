@@ -0,0 +1,2 @@
+ALTER TABLE sync_events DROP COLUMN IF EXISTS visible_to;
+ALTER TABLE encrypted_states DROP COLUMN IF EXISTS visible_to;
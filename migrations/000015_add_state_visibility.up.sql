@@ -0,0 +1,5 @@
+-- Device-scoped states: visible_to lists the devices that may read a state,
+-- NULL meaning every device of the account. Sync events copy the scope of
+-- the state they describe so delivery can be filtered per device.
+ALTER TABLE encrypted_states ADD COLUMN visible_to UUID[];
+ALTER TABLE sync_events ADD COLUMN visible_to UUID[];
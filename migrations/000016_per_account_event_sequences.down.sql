@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_sync_events_account_sequence;
+CREATE INDEX IF NOT EXISTS idx_sync_events_account_id ON sync_events(account_id, sequence_number);
+
+CREATE SEQUENCE sync_events_sequence_number_seq OWNED BY sync_events.sequence_number;
+SELECT setval('sync_events_sequence_number_seq', COALESCE((SELECT MAX(sequence_number) FROM sync_events), 0) + 1, false);
+ALTER TABLE sync_events ALTER COLUMN sequence_number SET DEFAULT nextval('sync_events_sequence_number_seq');
+
+DROP TABLE IF EXISTS sync_sequences;
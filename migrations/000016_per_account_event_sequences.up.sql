@@ -0,0 +1,20 @@
+-- Sync event sequence numbers are per account. Each account's counter row is
+-- locked by the transaction that takes a number and released at commit, so
+-- numbers are gapless (a rollback returns its number) and become visible in
+-- order: a later number can't commit before an earlier one.
+CREATE TABLE sync_sequences (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    last_sequence BIGINT NOT NULL
+);
+
+-- Accounts continue from their highest global number so existing device
+-- cursors stay valid
+INSERT INTO sync_sequences (account_id, last_sequence)
+SELECT account_id, MAX(sequence_number) FROM sync_events GROUP BY account_id;
+
+ALTER TABLE sync_events ALTER COLUMN sequence_number DROP DEFAULT;
+ALTER TABLE sync_events ALTER COLUMN sequence_number SET NOT NULL;
+DROP SEQUENCE sync_events_sequence_number_seq;
+
+DROP INDEX idx_sync_events_account_id;
+CREATE UNIQUE INDEX idx_sync_events_account_sequence ON sync_events(account_id, sequence_number);
@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS synced_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS synced_sequence;
@@ -0,0 +1,4 @@
+-- The highest sequence number each device has acknowledged applying, and
+-- when it last acknowledged. Cursors only move forward.
+ALTER TABLE devices ADD COLUMN synced_sequence BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN synced_at TIMESTAMPTZ;
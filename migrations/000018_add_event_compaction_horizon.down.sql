@@ -0,0 +1,2 @@
+ALTER TABLE sync_sequences DROP COLUMN IF EXISTS compacted_at;
+ALTER TABLE sync_sequences DROP COLUMN IF EXISTS compacted_through;
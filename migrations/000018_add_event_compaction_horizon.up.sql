@@ -0,0 +1,5 @@
+-- Events up to compacted_through have been compacted down to the latest
+-- event per state key. Devices whose cursor is older must resync from a
+-- snapshot instead of replaying the log.
+ALTER TABLE sync_sequences ADD COLUMN compacted_through BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE sync_sequences ADD COLUMN compacted_at TIMESTAMPTZ;
@@ -0,0 +1,12 @@
+CREATE TABLE sync_events_plain (LIKE sync_events INCLUDING DEFAULTS);
+INSERT INTO sync_events_plain SELECT * FROM sync_events;
+DROP TABLE sync_events;
+ALTER TABLE sync_events_plain RENAME TO sync_events;
+
+ALTER TABLE sync_events ADD PRIMARY KEY (id);
+ALTER TABLE sync_events ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE sync_events ADD CONSTRAINT sync_events_account_id_fkey FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+ALTER TABLE sync_events ADD CONSTRAINT sync_events_device_id_fkey FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE SET NULL;
+ALTER TABLE sync_events ADD CONSTRAINT sync_events_owner_account_id_fkey FOREIGN KEY (owner_account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+CREATE UNIQUE INDEX idx_sync_events_account_sequence ON sync_events(account_id, sequence_number);
+CREATE INDEX idx_sync_events_device_id ON sync_events(device_id, sequence_number);
@@ -0,0 +1,51 @@
+-- sync_events becomes range partitioned by created_at, one partition per
+-- month (UTC). The existing table is attached in place as the partition for
+-- everything before next month; the server creates partitions ahead of time
+-- and drops those past the retention window.
+ALTER TABLE sync_events RENAME TO sync_events_legacy;
+ALTER TABLE sync_events_legacy DROP CONSTRAINT sync_events_pkey;
+ALTER TABLE sync_events_legacy DROP CONSTRAINT sync_events_account_id_fkey;
+ALTER TABLE sync_events_legacy DROP CONSTRAINT sync_events_device_id_fkey;
+ALTER TABLE sync_events_legacy DROP CONSTRAINT sync_events_owner_account_id_fkey;
+DROP INDEX idx_sync_events_account_sequence;
+DROP INDEX idx_sync_events_device_id;
+
+UPDATE sync_events_legacy SET created_at = NOW() WHERE created_at IS NULL;
+ALTER TABLE sync_events_legacy ALTER COLUMN id SET NOT NULL;
+ALTER TABLE sync_events_legacy ALTER COLUMN created_at SET NOT NULL;
+
+CREATE TABLE sync_events (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    event_type VARCHAR(50) NOT NULL,
+    state_key VARCHAR(255),
+    sequence_number BIGINT NOT NULL,
+    payload BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    state_version BIGINT,
+    owner_account_id UUID REFERENCES accounts(id) ON DELETE CASCADE,
+    visible_to UUID[],
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+-- Sequence numbers stay unique per account through sync_sequences; a unique
+-- index would have to include created_at to be allowed here
+CREATE INDEX idx_sync_events_account_sequence ON sync_events(account_id, sequence_number);
+CREATE INDEX idx_sync_events_device_id ON sync_events(device_id, sequence_number);
+
+DO $$
+DECLARE
+    next_month TIMESTAMPTZ;
+    month TIMESTAMPTZ;
+BEGIN
+    -- Month arithmetic follows the session time zone; partitions are UTC months
+    PERFORM set_config('TimeZone', 'UTC', true);
+    next_month := date_trunc('month', NOW()) + INTERVAL '1 month';
+    EXECUTE format('ALTER TABLE sync_events ATTACH PARTITION sync_events_legacy FOR VALUES FROM (MINVALUE) TO (%L)', next_month);
+    FOR i IN 0..2 LOOP
+        month := next_month + make_interval(months => i);
+        EXECUTE format('CREATE TABLE %I PARTITION OF sync_events FOR VALUES FROM (%L) TO (%L)',
+                       'sync_events_p' || to_char(month, 'YYYYMM'), month, month + INTERVAL '1 month');
+    END LOOP;
+END $$;
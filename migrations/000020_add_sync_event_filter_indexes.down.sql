@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sync_events_account_type;
+DROP INDEX IF EXISTS idx_sync_events_account_key;
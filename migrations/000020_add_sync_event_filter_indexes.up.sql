@@ -0,0 +1,3 @@
+-- Filtered catch-up reads an account's events by key prefix or event type
+CREATE INDEX idx_sync_events_account_key ON sync_events(account_id, state_key COLLATE "C", sequence_number);
+CREATE INDEX idx_sync_events_account_type ON sync_events(account_id, event_type, sequence_number);
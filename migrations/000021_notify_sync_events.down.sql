@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS sync_events_notify ON sync_events;
+DROP FUNCTION IF EXISTS notify_sync_event();
@@ -0,0 +1,14 @@
+-- Wake long-polling and streaming readers on every server instance when an
+-- account gets new events. Notifications are only delivered once the
+-- inserting transaction commits, and identical payloads within one
+-- transaction are folded into one.
+CREATE FUNCTION notify_sync_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('sync_events', NEW.account_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER sync_events_notify
+    AFTER INSERT ON sync_events
+    FOR EACH ROW EXECUTE FUNCTION notify_sync_event();